@@ -1,13 +1,41 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// workerState is where a WorkerConfig is in its life. It's changed with atomics
+// since Stop() is called from the signal loop while the copy is going on.
+type workerState int32
+
+const (
+	workerPrepared workerState = iota + 1 // Validated, nothing opened yet
+	workerRunning
+	workerDraining // Stopped or out of blocks, the threads finish the block they have
+	workerDone
+)
+
+func (s workerState) String() string {
+	switch s {
+	case workerPrepared:
+		return "prepared"
+	case workerRunning:
+		return "running"
+	case workerDraining:
+		return "draining"
+	case workerDone:
+		return "done"
+	}
+	return "unknown"
+}
+
 type WorkerConfig struct {
 	SourceName string
 	TargetName string
@@ -28,8 +56,13 @@ type WorkerConfig struct {
 	acChan       chan AccessControl
 	thrComplete  chan int
 	workerFinish chan int
-	keepRunning  bool
 	stats        *StatData
+
+	// mu keeps Stop() in step with Start() setting up the context.
+	mu     sync.Mutex
+	state  int32
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type WorkTarget struct {
@@ -189,13 +222,25 @@ func (w *WorkerConfig) Validate() bool {
 	}
 	w.srcFile = nil
 	w.tgtFile = nil
+	atomic.StoreInt32(&w.state, int32(workerPrepared))
 
 	return true
 }
 
+// State returns where the worker is in its life.
+func (w *WorkerConfig) State() workerState {
+	return workerState(atomic.LoadInt32(&w.state))
+}
+
 func (w *WorkerConfig) Start(stats *StatData, exitChan chan int) {
 	w.workerFinish = exitChan
-	w.keepRunning = true
+	w.mu.Lock()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	if !atomic.CompareAndSwapInt32(&w.state, int32(workerPrepared), int32(workerRunning)) {
+		// Stopped before it started, hand out no blocks.
+		w.cancel()
+	}
+	w.mu.Unlock()
 	fmt.Printf("WorkerConfig Start called\n")
 	fmt.Printf("    Threads: %d\n    Block Size: %s\n    Copy Size: %s\n    From: %s\n    To: %s\n",
 		w.threads, Humanize(int64(w.blkSize), 1), Humanize(w.sizeToUse, 1),
@@ -211,10 +256,10 @@ func (w *WorkerConfig) Start(stats *StatData, exitChan chan int) {
 	w.tgtFile = NewWorkTarget(w.TargetName, w.openFlags)
 
 	w.acChan = make(chan AccessControl, 10000)
-	go w.blockControl()
-
 	w.thrComplete = make(chan int, 10)
 	w.stats = stats
+	go w.blockControl()
+
 	for i := 0; i < w.threads; i++ {
 		go w.readWriteWorker(i, stats)
 	}
@@ -234,8 +279,18 @@ func flagsToStr(flags int) string {
 	return rtnVal
 }
 
+// Stop has blockControl quit handing out blocks. It's safe to call from the
+// signal handling loop at any point, a worker which hasn't started yet won't
+// copy anything.
 func (w *WorkerConfig) Stop() {
-	w.keepRunning = false
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !atomic.CompareAndSwapInt32(&w.state, int32(workerRunning), int32(workerDraining)) {
+		atomic.CompareAndSwapInt32(&w.state, int32(workerPrepared), int32(workerDraining))
+	}
+	if w.cancel != nil {
+		w.cancel()
+	}
 }
 
 type AccessControl struct {
@@ -251,7 +306,7 @@ func (w *WorkerConfig) blockControl() {
 	var ac AccessControl
 	flip := true
 
-	for inputCurPos < w.sizeToUse && w.keepRunning {
+	for inputCurPos < w.sizeToUse && w.ctx.Err() == nil {
 		ac.inputSeekPos = inputCurPos
 		ac.outputSeekPos = outputCurPos
 		ac.stopAccess = false
@@ -269,6 +324,9 @@ func (w *WorkerConfig) blockControl() {
 		outputCurPos += int64(ac.blkSize)
 	}
 
+	// Out of blocks or stopped, either way the threads drain.
+	atomic.CompareAndSwapInt32(&w.state, int32(workerRunning), int32(workerDraining))
+
 	// Send the stop signal to the threads
 	for i := 0; i < w.threads; i++ {
 		ac.stopAccess = true
@@ -287,6 +345,7 @@ func (w *WorkerConfig) blockControl() {
 
 	w.srcFile.Close()
 	w.tgtFile.Close()
+	atomic.StoreInt32(&w.state, int32(workerDone))
 
 	// Let the main thread know we've tidied everything up.
 	w.workerFinish <- 1
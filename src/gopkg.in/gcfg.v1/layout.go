@@ -0,0 +1,101 @@
+package gcfg
+
+import (
+	"strings"
+)
+
+import (
+	"gopkg.in/gcfg.v1/token"
+)
+
+// Layout records where each section and variable was found in the source.
+// Sections are in the order their headers appear, so a section which appears
+// more than once has an entry for each header with the variables which
+// follow it.
+type Layout struct {
+	Sections []*SectionLayout
+}
+
+// SectionLayout is the position of a single section or subsection header and
+// the variables which follow it, in source order.
+type SectionLayout struct {
+	Section    string
+	Subsection string
+	Pos        token.Position
+	Vars       []*VarLayout
+}
+
+// VarLayout is the position of a single variable.
+type VarLayout struct {
+	Name  string
+	Value string
+	Pos   token.Position
+}
+
+func (l *Layout) add(sect, sub string, pos token.Position) *SectionLayout {
+	s := &SectionLayout{Section: sect, Subsection: sub, Pos: pos}
+	l.Sections = append(l.Sections, s)
+	return s
+}
+
+// Section returns the first header for the named section or nil if it wasn't
+// found. As when setting values the section name is matched ignoring case
+// while the subsection name must match exactly.
+func (l *Layout) Section(sect, sub string) *SectionLayout {
+	if l == nil {
+		return nil
+	}
+	for _, s := range l.Sections {
+		if strings.EqualFold(s.Section, sect) && s.Subsection == sub {
+			return s
+		}
+	}
+	return nil
+}
+
+// Var returns the last definition of the named variable in any of the headers
+// for the section or nil if there isn't one.
+func (l *Layout) Var(sect, sub, name string) *VarLayout {
+	if l == nil {
+		return nil
+	}
+	for i := len(l.Sections) - 1; i >= 0; i-- {
+		s := l.Sections[i]
+		if strings.EqualFold(s.Section, sect) && s.Subsection == sub {
+			if v := s.Var(name); v != nil {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// Subsections returns the subsection names used with sect in the order they
+// first appear.
+func (l *Layout) Subsections(sect string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, s := range l.Sections {
+		if strings.EqualFold(s.Section, sect) && s.Subsection != "" && !seen[s.Subsection] {
+			seen[s.Subsection] = true
+			names = append(names, s.Subsection)
+		}
+	}
+	return names
+}
+
+// Var returns the last definition of the named variable following this
+// header or nil if there isn't one. Names are matched ignoring case and '-'
+// matches '_'.
+func (s *SectionLayout) Var(name string) *VarLayout {
+	if s == nil {
+		return nil
+	}
+	name = strings.Replace(name, "_", "-", -1)
+	for i := len(s.Vars) - 1; i >= 0; i-- {
+		if strings.EqualFold(strings.Replace(s.Vars[i].Name, "_", "-", -1), name) {
+			return s.Vars[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package gcfg
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+import (
+	"gopkg.in/gcfg.v1/scanner"
+)
+
+// Every readtest must give the same result when read with a layout.
+func TestReadStringIntoLayoutMatches(t *testing.T) {
+	for _, tg := range readtests {
+		for i, tt := range tg.tests {
+			id := fmt.Sprintf("%s:%d", tg.group, i)
+			res := reflect.New(reflect.TypeOf(tt.exp).Elem()).Interface()
+			_, err := ReadStringIntoLayout(res, "test", tt.gcfg)
+			if tt.ok && err != nil {
+				t.Errorf("%s fail: got error %v, wanted ok", id, err)
+			} else if tt.ok && !reflect.DeepEqual(res, tt.exp) {
+				t.Errorf("%s fail: got value %#v, wanted value %#v", id, res, tt.exp)
+			} else if !tt.ok && err == nil {
+				t.Errorf("%s fail: got value %#v, wanted error", id, res)
+			}
+		}
+	}
+}
+
+func TestReadStringIntoLayoutPositions(t *testing.T) {
+	res := &cBasic{}
+	layout, err := ReadStringIntoLayout(res, "test.gcfg",
+		"; comment\n[section]\nname=value\n\n[hyphen-in-section]\n  hyphen-in-name = x\n[Section]\nint=5\n")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(layout.Sections) != 3 {
+		t.Fatalf("got %d sections, wanted 3", len(layout.Sections))
+	}
+	checks := []struct {
+		sect, name string
+		line, col  int
+	}{
+		{"section", "name", 3, 1},
+		{"hyphen-in-section", "hyphen_in_name", 6, 3},
+		{"SECTION", "int", 8, 1},
+	}
+	for _, c := range checks {
+		v := layout.Var(c.sect, "", c.name)
+		if v == nil {
+			t.Errorf("%s.%s not found", c.sect, c.name)
+			continue
+		}
+		if v.Pos.Filename != "test.gcfg" || v.Pos.Line != c.line || v.Pos.Column != c.col {
+			t.Errorf("%s.%s at %s, wanted line %d column %d", c.sect, c.name, v.Pos, c.line, c.col)
+		}
+	}
+	if p := layout.Section("section", "").Pos; p.Line != 2 {
+		t.Errorf("[section] at %s, wanted line 2", p)
+	}
+}
+
+func TestReadStringIntoLayoutAllErrors(t *testing.T) {
+	res := &cBasic{}
+	_, err := ReadStringIntoLayout(res, "test.gcfg",
+		"[section]\nname=value\nbogus=1\nint=x\n[nosuch]\nname=y\n[section\nname=z\n[section]\n=\nint=7\n")
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got %#v, wanted scanner.ErrorList", err)
+	}
+	lines := []int{3, 4, 5, 7, 10}
+	if len(list) != len(lines) {
+		t.Fatalf("got %d errors, wanted %d: %v", len(list), len(lines), list)
+	}
+	for i, e := range list {
+		if e.Pos.Line != lines[i] {
+			t.Errorf("error %d at line %d, wanted %d: %s", i, e.Pos.Line, lines[i], e)
+		}
+	}
+	if res.Section.Name != "value" || res.Section.Int != 7 {
+		t.Errorf("parsing didn't continue after errors: %#v", res.Section)
+	}
+}
+
+func TestLayoutSubsectionOrder(t *testing.T) {
+	res := &struct {
+		Job     map[string]*struct{ Name string }
+		Barrier struct{}
+	}{}
+	layout, err := ReadStringIntoLayout(res, "test.gcfg",
+		"[job \"zeta\"]\n[job \"alpha\"]\nname=a\n[barrier]\n[job \"mid\"]\n[job \"zeta\"]\nname=z\n")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []string{"zeta", "alpha", "mid"}
+	if got := layout.Subsections("job"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	var order []string
+	for _, s := range layout.Sections {
+		order = append(order, s.Section+":"+s.Subsection)
+	}
+	want = []string{"job:zeta", "job:alpha", "barrier:", "job:mid", "job:zeta"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("got %v, wanted %v", order, want)
+	}
+	if v := layout.Var("job", "zeta", "name"); v == nil || v.Pos.Line != 7 {
+		t.Errorf("got %v for zeta name, wanted line 7", v)
+	}
+}
@@ -1,7 +1,6 @@
 package gcfg
 
 import (
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -49,106 +48,180 @@ func unquote(s string) string {
 	return string(u)
 }
 
-func readInto(config interface{}, fset *token.FileSet, file *token.File, src []byte) error {
-	var s scanner.Scanner
-	var errs scanner.ErrorList
-	s.Init(file, src, func(p token.Position, m string) { errs.Add(p, m) }, 0)
-	sect, sectsub := "", ""
-	pos, tok, lit := s.Scan()
-	errfn := func(msg string) error {
-		return fmt.Errorf("%s: %s", fset.Position(pos), msg)
+// reader holds the state while parsing a single source. When layout is set the
+// position of each section and variable is recorded and errors are collected so
+// that parsing can continue with the next line.
+type reader struct {
+	s        scanner.Scanner
+	scanErrs scanner.ErrorList
+	errs     scanner.ErrorList
+	fset     *token.FileSet
+	config   interface{}
+	layout   *Layout
+
+	sect, sectsub string
+	section       *SectionLayout
+	badSection    bool
+
+	pos token.Pos
+	tok token.Token
+	lit string
+}
+
+func (r *reader) next() error {
+	r.pos, r.tok, r.lit = r.s.Scan()
+	if r.scanErrs.Len() > 0 {
+		err := r.scanErrs.Err()
+		r.scanErrs = nil
+		return err
+	}
+	return nil
+}
+
+func (r *reader) errorf(msg string) error {
+	return &scanner.Error{Pos: r.fset.Position(r.pos), Msg: msg}
+}
+
+// skipLine moves past the rest of a line containing an error.
+func (r *reader) skipLine() {
+	for r.tok != token.EOL && r.tok != token.EOF {
+		_ = r.next()
+	}
+}
+
+// record adds err to the list of errors. Only used when collecting errors.
+func (r *reader) record(err error) {
+	switch e := err.(type) {
+	case scanner.ErrorList:
+		r.errs = append(r.errs, e...)
+	case *scanner.Error:
+		r.errs = append(r.errs, e)
+	default:
+		r.errs.Add(r.fset.Position(r.pos), err.Error())
+	}
+}
+
+func (r *reader) header() error {
+	r.sect, r.sectsub, r.badSection = "", "", true
+	if err := r.next(); err != nil {
+		return err
+	}
+	if r.tok != token.IDENT {
+		return r.errorf("expected section name")
 	}
+	sect, sectsub, pos := r.lit, "", r.pos
+	if err := r.next(); err != nil {
+		return err
+	}
+	if r.tok == token.STRING {
+		sectsub = unquote(r.lit)
+		if sectsub == "" {
+			return r.errorf("empty subsection name")
+		}
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+	if r.tok != token.RBRACK {
+		if sectsub == "" {
+			return r.errorf("expected subsection name or right bracket")
+		}
+		return r.errorf("expected right bracket")
+	}
+	if err := r.next(); err != nil {
+		return err
+	}
+	if r.tok != token.EOL && r.tok != token.EOF && r.tok != token.COMMENT {
+		return r.errorf("expected EOL, EOF, or comment")
+	}
+	r.sect, r.sectsub, r.badSection = sect, sectsub, false
+	if r.layout != nil {
+		r.section = r.layout.add(sect, sectsub, r.fset.Position(pos))
+	}
+	// If a section/subsection header was found, ensure a
+	// container object is created, even if there are no
+	// variables further down.
+	if err := set(r.config, sect, sectsub, "", true, ""); err != nil {
+		r.badSection = true
+		return &scanner.Error{Pos: r.fset.Position(pos), Msg: err.Error()}
+	}
+	return nil
+}
+
+func (r *reader) variable() error {
+	if r.badSection {
+		// Already reported the broken header.
+		r.skipLine()
+		return nil
+	}
+	if r.sect == "" {
+		return r.errorf("expected section header")
+	}
+	n, pos := r.lit, r.pos
+	if err := r.next(); err != nil {
+		return err
+	}
+	blank, v := r.tok == token.EOF || r.tok == token.EOL || r.tok == token.COMMENT, ""
+	if !blank {
+		if r.tok != token.ASSIGN {
+			return r.errorf("expected '='")
+		}
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.tok != token.STRING {
+			return r.errorf("expected value")
+		}
+		v = unquote(r.lit)
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.tok != token.EOL && r.tok != token.EOF && r.tok != token.COMMENT {
+			return r.errorf("expected EOL, EOF, or comment")
+		}
+	}
+	if r.section != nil {
+		r.section.Vars = append(r.section.Vars, &VarLayout{Name: n, Value: v, Pos: r.fset.Position(pos)})
+	}
+	if err := set(r.config, r.sect, r.sectsub, n, blank, v); err != nil {
+		if r.layout == nil {
+			return err
+		}
+		return &scanner.Error{Pos: r.fset.Position(pos), Msg: err.Error()}
+	}
+	return nil
+}
+
+func readInto(config interface{}, fset *token.FileSet, file *token.File, src []byte, layout *Layout) error {
+	r := &reader{fset: fset, config: config, layout: layout}
+	r.s.Init(file, src, func(p token.Position, m string) { r.scanErrs.Add(p, m) }, 0)
+	err := r.next()
 	for {
-		if errs.Len() > 0 {
-			return errs.Err()
+		if err != nil {
+			if layout == nil {
+				return err
+			}
+			r.record(err)
+			r.skipLine()
 		}
-		switch tok {
+		switch r.tok {
 		case token.EOF:
-			return nil
+			r.errs.Sort()
+			return r.errs.Err()
 		case token.EOL, token.COMMENT:
-			pos, tok, lit = s.Scan()
+			err = r.next()
 		case token.LBRACK:
-			pos, tok, lit = s.Scan()
-			if errs.Len() > 0 {
-				return errs.Err()
-			}
-			if tok != token.IDENT {
-				return errfn("expected section name")
-			}
-			sect, sectsub = lit, ""
-			pos, tok, lit = s.Scan()
-			if errs.Len() > 0 {
-				return errs.Err()
-			}
-			if tok == token.STRING {
-				sectsub = unquote(lit)
-				if sectsub == "" {
-					return errfn("empty subsection name")
-				}
-				pos, tok, lit = s.Scan()
-				if errs.Len() > 0 {
-					return errs.Err()
-				}
-			}
-			if tok != token.RBRACK {
-				if sectsub == "" {
-					return errfn("expected subsection name or right bracket")
-				}
-				return errfn("expected right bracket")
-			}
-			pos, tok, lit = s.Scan()
-			if tok != token.EOL && tok != token.EOF && tok != token.COMMENT {
-				return errfn("expected EOL, EOF, or comment")
-			}
-			// If a section/subsection header was found, ensure a
-			// container object is created, even if there are no
-			// variables further down.
-			err := set(config, sect, sectsub, "", true, "")
-			if err != nil {
-				return err
-			}
+			err = r.header()
 		case token.IDENT:
-			if sect == "" {
-				return errfn("expected section header")
-			}
-			n := lit
-			pos, tok, lit = s.Scan()
-			if errs.Len() > 0 {
-				return errs.Err()
-			}
-			blank, v := tok == token.EOF || tok == token.EOL || tok == token.COMMENT, ""
-			if !blank {
-				if tok != token.ASSIGN {
-					return errfn("expected '='")
-				}
-				pos, tok, lit = s.Scan()
-				if errs.Len() > 0 {
-					return errs.Err()
-				}
-				if tok != token.STRING {
-					return errfn("expected value")
-				}
-				v = unquote(lit)
-				pos, tok, lit = s.Scan()
-				if errs.Len() > 0 {
-					return errs.Err()
-				}
-				if tok != token.EOL && tok != token.EOF && tok != token.COMMENT {
-					return errfn("expected EOL, EOF, or comment")
-				}
-			}
-			err := set(config, sect, sectsub, n, blank, v)
-			if err != nil {
-				return err
-			}
+			err = r.variable()
 		default:
-			if sect == "" {
-				return errfn("expected section header")
+			if r.sect == "" && !r.badSection {
+				err = r.errorf("expected section header")
+			} else {
+				err = r.errorf("expected section header or variable declaration")
 			}
-			return errfn("expected section header or variable declaration")
 		}
 	}
-	panic("never reached")
 }
 
 // ReadInto reads gcfg formatted data from reader and sets the values into the
@@ -160,7 +233,7 @@ func ReadInto(config interface{}, reader io.Reader) error {
 	}
 	fset := token.NewFileSet()
 	file := fset.AddFile("", fset.Base(), len(src))
-	return readInto(config, fset, file, src)
+	return readInto(config, fset, file, src, nil)
 }
 
 // ReadStringInto reads gcfg formatted data from str and sets the values into
@@ -184,5 +257,25 @@ func ReadFileInto(config interface{}, filename string) error {
 	}
 	fset := token.NewFileSet()
 	file := fset.AddFile(filename, fset.Base(), len(src))
-	return readInto(config, fset, file, src)
+	return readInto(config, fset, file, src, nil)
+}
+
+// ReadStringIntoLayout is like ReadStringInto except every error found is
+// returned as a scanner.ErrorList instead of stopping at the first one, and the
+// position of each section and variable is returned. filename is only used
+// when reporting positions.
+func ReadStringIntoLayout(config interface{}, filename, str string) (*Layout, error) {
+	layout := &Layout{}
+	fset := token.NewFileSet()
+	file := fset.AddFile(filename, fset.Base(), len(str))
+	return layout, readInto(config, fset, file, []byte(str), layout)
+}
+
+// ReadFileIntoLayout is the ReadFileInto version of ReadStringIntoLayout.
+func ReadFileIntoLayout(config interface{}, filename string) (*Layout, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ReadStringIntoLayout(config, filename, string(src))
 }
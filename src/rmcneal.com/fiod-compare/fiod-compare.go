@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"rmcneal.com/support"
+)
+
+// fiod-compare checks the JSON report of a run against one or more earlier
+// reports. The exit code is 0 when nothing regressed, 1 when something did,
+// and 2 if the reports couldn't be read.
+
+var thresholds support.CompareThresholds
+
+func init() {
+	flag.Float64Var(&thresholds.IOPS, "iops", 5, "Percentage drop in IOPS which is a regression")
+	flag.Float64Var(&thresholds.BW, "bw", 5, "Percentage drop in bandwidth which is a regression")
+	flag.Float64Var(&thresholds.Latency, "lat", 10,
+		"Percentage increase in average latency or a percentile which is a regression")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [options] baseline.json [baseline.json ...] current.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var reports []*support.Report
+	for _, name := range flag.Args() {
+		report, err := support.ReadReport(name)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(2)
+		}
+		reports = append(reports, report)
+	}
+	baselines, current := reports[:len(reports)-1], reports[len(reports)-1]
+
+	c := support.CompareReports(baselines, current, thresholds)
+	fmt.Printf("%s\n", c)
+	if n := c.Regressions(); n != 0 {
+		fmt.Printf("%d regression(s) beyond iops %.1f%%, bw %.1f%%, lat %.1f%%\n", n, thresholds.IOPS,
+			thresholds.BW, thresholds.Latency)
+		os.Exit(1)
+	}
+}
@@ -5,9 +5,14 @@ import (
 	"os"
 	"rmcneal.com/support"
 	"runtime"
+	"strings"
+	"time"
 )
 
 var inputFile string
+var jsonFile string
+var htmlFile string
+var checkOnly bool
 
 func init() {
 	const (
@@ -16,6 +21,9 @@ func init() {
 	)
 	flag.StringVar(&inputFile, "jobs_file", defaultFile, usage)
 	flag.StringVar(&inputFile, "j", defaultFile, usage+" (shorthand)")
+	flag.StringVar(&jsonFile, "json", "", "Write the results for each job to this file as JSON")
+	flag.StringVar(&htmlFile, "html", "", "Write the results with charts to this file as a single HTML page")
+	flag.BoolVar(&checkOnly, "check", false, "Validate the job file and display the jobs without running them")
 }
 
 func main() {
@@ -23,8 +31,6 @@ func main() {
 	var err error
 	var stats *support.StatsState = nil
 
-	jobs := map[string]*support.Job{}
-
 	// All early returns are error conditions so the default will
 	// be an non-zero exit code. Only at the end after all tests
 	// have been completed successfully will the exitCode be set
@@ -44,7 +50,21 @@ func main() {
 	}()
 
 	if cfg, err = support.ReadConfig(inputFile); err != nil {
-		printer.Send("Config failure: %s\n", err)
+		if errs, ok := err.(support.ConfigErrors); ok {
+			printer.Send("Config failure:\n")
+			for _, e := range errs {
+				printer.Send("  %s\n", e)
+			}
+		} else {
+			printer.Send("Config failure: %s\n", err)
+		}
+		return
+	}
+
+	if checkOnly {
+		if checkConfig(cfg, printer) {
+			exitCode = 0
+		}
 		return
 	}
 
@@ -69,80 +89,74 @@ func main() {
 			titleCol, "job-order", cfg.Global.Job_Order)
 	}
 
-	track := support.TrackingInit(printer)
-	for _, perBarrier := range *cfg.GetBarrierOrder() {
-
-		for _, name := range perBarrier {
-			if jd, ok := cfg.Job[name]; !ok {
-				printer.Send("\nBad name in job list -- '%s'\n", name)
-			} else {
-				if job, err := support.JobInit(name, jd, stats); err != nil {
-					printer.Send("[%s] %s\n", name, err)
-					return
-				} else {
-					jobs[name] = job
-				}
-				if cfg.Global.Verbose {
-					printer.Send("---- [%s] ----\n", name)
-					support.DisplayInterface(cfg.Job[name], printer)
-				}
-			}
-		}
-
-		track.SetTitle("Preparing")
-		if len(perBarrier) < 10 {
-			track.DisplayExtra()
-		} else {
-			track.DisplayCount()
-		}
+	// Jobs start as the jobs they wait for complete. Plain job-order and
+	// barriers end up as the same thing.
+	if !support.NewScheduler(cfg, stats, printer).Run() {
+		return
+	}
 
-		for _, name := range perBarrier {
-			job := jobs[name]
-			track.RunFunc(name, func() bool {
-				if err := job.FillAsNeeded(track); err == nil {
-					return true
-				} else {
-					printer.Send("\nERROR: [%s] %s\n", job.GetName(), err)
-					return false
-				}
-			}, func() { job.AbortPrep() })
+	if cfg.HaveSweeps() {
+		support.PrintSweepTable(stats.Results(), printer)
+	}
+	// Checked before the reports are written so the outcomes are in them.
+	failed := 0
+	if checks := support.CheckAssertions(cfg, stats.Results()); len(checks) != 0 {
+		printer.Send("Assertions\n%s\n", support.AssertionTable(checks))
+		failed = support.AssertionsFailed(checks)
+	}
+	report := &support.Report{Version: 1, JobFile: inputFile, Created: time.Now(), Jobs: stats.Results()}
+	if jsonFile != "" {
+		if err := support.WriteReport(jsonFile, report); err != nil {
+			printer.Send("Failed to write %s: %s\n", jsonFile, err)
+			return
 		}
-		if !track.WaitForThreads() {
-			break
+	}
+	if htmlFile != "" {
+		if err := support.WriteHTMLReport(htmlFile, report); err != nil {
+			printer.Send("Failed to write %s: %s\n", htmlFile, err)
+			return
 		}
-		track.DisplayReset()
-
-		track.SetTitle("Run")
-		track.DisplaySet(func() { printer.Send(stats.String()) })
-
-		// Clear out the stats just before starting the jobs. The timer is running
-		// in the stats thread which means the time spent during the prepare phase
-		// would be counted against the elapsed time for these threads if we don't
-		// clear the stats now.
-		stats.Send(support.StatsRecord{OpType: support.StatClear})
+	}
+	if failed != 0 {
+		// Kept apart from 1 so a CI run can tell a slow result from
+		// one which didn't work at all.
+		exitCode = 2
+		return
+	}
+	exitCode = 0
+}
 
-		for _, name := range perBarrier {
-			job := jobs[name]
-			track.RunFunc(name, func() bool {
-				job.Start()
-				return true
-			}, func() { job.Stop() })
+// checkConfig displays what would be run without touching any of the targets.
+// Returns false if any job has a problem.
+func checkConfig(cfg *support.Configs, printer *support.Printer) bool {
+	ok := true
+	printer.Send("---- Global ----\n")
+	support.DisplayInterface(&cfg.Global, printer)
+	for idx, perBarrier := range *cfg.GetBarrierOrder() {
+		printer.Send("Barrier %d: %s\n", idx, strings.Join(perBarrier, ", "))
+	}
+	for _, name := range *cfg.GetJobsList() {
+		jd := cfg.Job[name]
+		if waitFor := jd.GetWaitFor(); len(waitFor) != 0 || jd.GetStartAfter() != 0 {
+			printer.Send("[%s] waits for: %s, start after: %s\n", name, strings.Join(waitFor, ", "),
+				jd.GetStartAfter())
 		}
-		track.WaitForThreads()
-		track.DisplayReset()
-		stats.Send(support.StatsRecord{OpType: support.StatDisplay})
-		stats.Flush()
-
-		track.SetTitle("Clean up")
-		track.DisplayCount()
+	}
+	for _, perBarrier := range *cfg.GetBarrierOrder() {
 		for _, name := range perBarrier {
-			job := jobs[name]
-			track.RunFunc(name, func() bool {
-				job.Fini()
-				return true
-			}, nil)
+			if jd, found := cfg.Job[name]; !found {
+				printer.Send("Bad name in job list -- '%s'\n", name)
+				ok = false
+			} else if err := support.CheckJob(name, jd, printer); err != nil {
+				printer.Send("%s\n", err)
+				ok = false
+			}
 		}
-		track.WaitForThreads()
 	}
-	exitCode = 0
+	if ok {
+		printer.Send("Configuration OK\n")
+	} else {
+		printer.Send("Configuration has errors\n")
+	}
+	return ok
 }
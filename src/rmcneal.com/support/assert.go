@@ -0,0 +1,158 @@
+package support
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// assertion is a single check of a job's results from one of the assert-...
+// options. A min check passes when the value is at least the limit, a max
+// check when it's no more than the limit.
+type assertion struct {
+	check string
+	max   bool
+	limit int64
+	value func(r *JobResult) int64
+	show  func(v int64) string
+}
+
+// AssertionResult is the outcome of one check of a job.
+type AssertionResult struct {
+	Job    string
+	Check  string
+	Limit  string
+	Actual string
+	Pass   bool
+}
+
+// Percentiles which can be used by assert-max-lat.
+var assertPercentiles = map[string]func(r *JobResult) time.Duration{
+	"p50":   func(r *JobResult) time.Duration { return r.Latency.P50 },
+	"p90":   func(r *JobResult) time.Duration { return r.Latency.P90 },
+	"p99":   func(r *JobResult) time.Duration { return r.Latency.P99 },
+	"p99.9": func(r *JobResult) time.Duration { return r.Latency.P999 },
+}
+
+func showCount(v int64) string {
+	return strings.TrimSpace(Humanize(v, 1))
+}
+
+func showDuration(v int64) string {
+	return time.Duration(v).String()
+}
+
+//
+// parseAssertions -- convert the assert-... options into the checks made after the run
+//
+// assert-min-iops and assert-min-bw take a number which can use the same k, m, g
+// suffixes as sizes. assert-max-lat is one or more <percentile>:<time> pairs such as
+// p99:5ms,p50:500us where the percentile is p50, p90, p99 or p99.9. assert-max-errors
+// is the number of failed I/O's allowed, usually 0.
+//
+func (j *JobData) parseAssertions(section string) error {
+	var errs ConfigErrors
+	j.asserts = nil
+	if j.Assert_Min_Iops != "" {
+		if v, ok := BlkStringToInt64(j.Assert_Min_Iops); !ok || v <= 0 {
+			errs.add(section, "assert-min-iops", "invalid assert-min-iops value %s", j.Assert_Min_Iops)
+		} else {
+			j.asserts = append(j.asserts, assertion{check: "min IOPS", limit: v,
+				value: func(r *JobResult) int64 { return r.IOPS }, show: showCount})
+		}
+	}
+	if j.Assert_Min_Bw != "" {
+		if v, ok := BlkStringToInt64(j.Assert_Min_Bw); !ok || v <= 0 {
+			errs.add(section, "assert-min-bw", "invalid assert-min-bw value %s", j.Assert_Min_Bw)
+		} else {
+			j.asserts = append(j.asserts, assertion{check: "min BW", limit: v,
+				value: func(r *JobResult) int64 { return r.BW }, show: showCount})
+		}
+	}
+	for _, l := range strings.FieldsFunc(j.Assert_Max_Lat, FindComma) {
+		params := strings.Split(strings.TrimSpace(l), ":")
+		var percentile func(r *JobResult) time.Duration
+		var dur time.Duration
+		var err error
+		if len(params) == 2 {
+			percentile = assertPercentiles[strings.ToLower(params[0])]
+			dur, err = time.ParseDuration(params[1])
+		}
+		if percentile == nil || err != nil || dur <= 0 {
+			errs.add(section, "assert-max-lat", "invalid assert-max-lat '%s', should be <percentile>:<time> like p99:5ms",
+				strings.TrimSpace(l))
+			continue
+		}
+		j.asserts = append(j.asserts, assertion{check: "max " + strings.ToUpper(params[0]), max: true,
+			limit: int64(dur), value: func(r *JobResult) int64 { return int64(percentile(r)) }, show: showDuration})
+	}
+	if j.Assert_Max_Errors != "" {
+		if v, err := strconv.ParseInt(j.Assert_Max_Errors, 10, 64); err != nil || v < 0 {
+			errs.add(section, "assert-max-errors", "invalid assert-max-errors value %s", j.Assert_Max_Errors)
+		} else {
+			j.asserts = append(j.asserts, assertion{check: "max errors", max: true, limit: v,
+				value: func(r *JobResult) int64 { return r.Errors },
+				show:  func(v int64) string { return strconv.FormatInt(v, 10) }})
+		}
+	}
+	return errs.err()
+}
+
+//
+// CheckAssertions -- apply the assert-... options of every job to its results
+//
+// Each outcome is also added to the job's results so it ends up in the JSON
+// report. A job with checks which has no results, because the run ended before
+// it started, fails all of them.
+//
+func CheckAssertions(cfg *Configs, results []*JobResult) []*AssertionResult {
+	byName := map[string]*JobResult{}
+	for _, r := range results {
+		byName[r.Name] = r
+	}
+	var checks []*AssertionResult
+	for _, name := range *cfg.GetJobsList() {
+		r := byName[name]
+		for _, a := range cfg.Job[name].asserts {
+			ar := &AssertionResult{Job: name, Check: a.check, Limit: a.show(a.limit), Actual: "not run"}
+			if r != nil {
+				v := a.value(r)
+				ar.Actual = a.show(v)
+				if a.max {
+					ar.Pass = v <= a.limit
+				} else {
+					ar.Pass = v >= a.limit
+				}
+				r.Assertions = append(r.Assertions, ar)
+			}
+			checks = append(checks, ar)
+		}
+	}
+	return checks
+}
+
+// AssertionsFailed counts the checks which didn't pass.
+func AssertionsFailed(checks []*AssertionResult) int {
+	n := 0
+	for _, ar := range checks {
+		if !ar.Pass {
+			n++
+		}
+	}
+	return n
+}
+
+// AssertionTable shows every check with PASS or FAIL.
+func AssertionTable(checks []*AssertionResult) string {
+	var rows [][]string
+	for _, ar := range checks {
+		result := "PASS"
+		if !ar.Pass {
+			result = "FAIL"
+		}
+		rows = append(rows, []string{ar.Job, ar.Check, ar.Limit, ar.Actual, result})
+	}
+	return FormatTable([]string{"Job", "Check", "Limit", "Actual", "Result"}, rows, 2) +
+		fmt.Sprintf("\n%d of %d checks failed", AssertionsFailed(checks), len(checks))
+}
@@ -0,0 +1,67 @@
+package support
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssertions(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+access-pattern=100:randread:4k
+assert-max-errors=0
+
+[job "a"]
+assert-min-iops=10k
+assert-max-lat=p99:5ms, p50:1ms
+
+[job "b"]
+assert-min-bw=1m
+
+[job "c"]
+assert-min-iops=1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []*JobResult{
+		{Name: "a", IOPS: 20 * 1024, Latency: LatencyPercentiles{P50: 2 * time.Millisecond, P99: 4 * time.Millisecond}},
+		{Name: "b", BW: 512 * 1024, Errors: 3},
+	}
+	checks := CheckAssertions(cfg, results)
+	want := []struct {
+		job, check string
+		pass       bool
+	}{
+		{"a", "min IOPS", true}, {"a", "max P99", true}, {"a", "max P50", false}, {"a", "max errors", true},
+		{"b", "min BW", false}, {"b", "max errors", false},
+		{"c", "min IOPS", false}, {"c", "max errors", false},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("got %d checks, wanted %d:\n%s", len(checks), len(want), AssertionTable(checks))
+	}
+	for i, w := range want {
+		if c := checks[i]; c.Job != w.job || c.Check != w.check || c.Pass != w.pass {
+			t.Errorf("check %d is %+v, wanted %+v", i, c, w)
+		}
+	}
+	if checks[6].Actual != "not run" || AssertionsFailed(checks) != 5 || len(results[0].Assertions) != 4 {
+		t.Errorf("c: %+v, %d failed", checks[6], AssertionsFailed(checks))
+	}
+
+	_, err = readTestConfig(t, `
+[global]
+version=1
+size=1g
+access-pattern=100:randread:4k
+
+[job "a"]
+assert-max-lat=p98:1ms
+assert-max-errors=-1
+`)
+	if errs, ok := err.(ConfigErrors); !ok || len(errs) != 2 {
+		t.Errorf("got %v, wanted errors for assert-max-lat and assert-max-errors", err)
+	}
+}
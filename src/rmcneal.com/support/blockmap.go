@@ -0,0 +1,66 @@
+package support
+
+import (
+	"math/bits"
+)
+
+//
+// blockMap -- random without replacement
+//
+// Tracks which blocks of a random section have been used during the current pass
+// so that every block is visited exactly once before any block is repeated. The
+// random pick is used as a starting point and the first unused block at or after
+// it is taken. Once every block has been used the map is cleared and another
+// pass starts.
+//
+type blockMap struct {
+	bits   []uint64
+	blocks int64
+	used   int64
+	passes int64
+}
+
+func newBlockMap(blocks int64) *blockMap {
+	m := &blockMap{blocks: blocks, bits: make([]uint64, (blocks+63)/64)}
+	m.clear()
+	return m
+}
+
+func (m *blockMap) clear() {
+	for i := range m.bits {
+		m.bits[i] = 0
+	}
+	// Blocks past the end of the last word are marked as used so the
+	// search never returns them.
+	if extra := m.blocks % 64; extra != 0 {
+		m.bits[len(m.bits)-1] = ^uint64(0) << uint(extra)
+	}
+	m.used = 0
+}
+
+// next returns the first unused block at or after start, wrapping around.
+func (m *blockMap) next(start int64) int64 {
+	if m.used == m.blocks {
+		m.passes++
+		m.clear()
+	}
+	word := start / 64
+	free := ^m.bits[word] & (^uint64(0) << uint(start%64))
+	for free == 0 {
+		word++
+		if word == int64(len(m.bits)) {
+			word = 0
+		}
+		free = ^m.bits[word]
+	}
+	bit := int64(bits.TrailingZeros64(free))
+	m.bits[word] |= 1 << uint(bit)
+	m.used++
+	return word*64 + bit
+}
+
+// coverage is the number of passes made over the section so far, including
+// the fraction of the current pass.
+func (m *blockMap) coverage() float64 {
+	return float64(m.passes) + float64(m.used)/float64(m.blocks)
+}
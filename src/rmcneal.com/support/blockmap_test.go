@@ -0,0 +1,25 @@
+package support
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBlockMapCoverage(t *testing.T) {
+	for _, blocks := range []int64{1, 63, 64, 65, 1000} {
+		m := newBlockMap(blocks)
+		for pass := int64(0); pass < 3; pass++ {
+			seen := make([]bool, blocks)
+			for i := int64(0); i < blocks; i++ {
+				b := m.next(rand.Int63n(blocks))
+				if b < 0 || b >= blocks || seen[b] {
+					t.Fatalf("%d blocks, pass %d: block %d repeated or out of range", blocks, pass, b)
+				}
+				seen[b] = true
+			}
+			if m.coverage() != float64(pass+1) {
+				t.Errorf("%d blocks: coverage %f after pass %d", blocks, m.coverage(), pass)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package support
+
+import (
+	"math/bits"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// bufAlign is the alignment of every pooled buffer and of each offset into the
+// write pattern, enough for O_DIRECT on devices with 4k sectors.
+const bufAlign = 4096
+
+// patternWindow is how far past the largest block each worker's write
+// pattern goes, so the window holds many writes before it's filled again.
+const patternWindow = 1024 * 1024
+
+// alignedBuf returns size bytes starting on a bufAlign boundary.
+func alignedBuf(size int) []byte {
+	b := make([]byte, size+bufAlign)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&b[0])) & (bufAlign - 1)); rem != 0 {
+		off = bufAlign - rem
+	}
+	return b[off : off+size : off+size]
+}
+
+// sizeClass is the power of two, no smaller than bufAlign, which a buffer for
+// an I/O of size bytes is taken from.
+func sizeClass(size int64) int {
+	if size <= bufAlign {
+		return bits.Len(bufAlign - 1)
+	}
+	return bits.Len64(uint64(size - 1))
+}
+
+//
+// bufPool -- the I/O buffers of a job
+//
+// A worker used to make a new buffer whenever the size of the I/O changed,
+// which with a mix of block sizes meant an allocation and a pattern fill for
+// almost every I/O. Buffers are now handed out by size class and kept by the
+// worker for the rest of the run, then returned so a later Start() or the
+// next worker reuses them.
+//
+type bufPool struct {
+	mu   sync.Mutex
+	free [64][][]byte
+
+	// Number of buffers which had to be allocated.
+	allocs int64
+}
+
+func (p *bufPool) get(class int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.free[class]); n > 0 {
+		b := p.free[class][n-1]
+		p.free[class] = p.free[class][:n-1]
+		return b
+	}
+	atomic.AddInt64(&p.allocs, 1)
+	return alignedBuf(1 << uint(class))
+}
+
+func (p *bufPool) put(class int, b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.free[class] = append(p.free[class], b[:cap(b)])
+}
+
+// Allocations returns how many buffers the pool has made.
+func (p *bufPool) Allocations() int64 {
+	return atomic.LoadInt64(&p.allocs)
+}
+
+// workerBufs are the buffers a single worker has taken from the pool, at most
+// one for each size class.
+type workerBufs struct {
+	pool *bufPool
+	bufs [64][]byte
+}
+
+// get returns a buffer for an I/O of size bytes. The contents are whatever the
+// last I/O of the same size class left behind.
+func (w *workerBufs) get(size int64) []byte {
+	class := sizeClass(size)
+	b := w.bufs[class]
+	if b == nil {
+		b = w.pool.get(class)
+		w.bufs[class] = b
+	}
+	return b[:size]
+}
+
+// release gives every buffer back to the pool.
+func (w *workerBufs) release() {
+	for class, b := range w.bufs {
+		if b != nil {
+			w.pool.put(class, b)
+			w.bufs[class] = nil
+		}
+	}
+}
+
+//
+// patternStream -- the data written by a single worker
+//
+// Filling a buffer for every write costs more CPU than the write itself for
+// small blocks. Instead each worker fills a window of data a time and hands
+// out the next unused part of it for each new write, so no two writes share
+// data and targets which dedup or compress see the same data as before. Once
+// the window is used up it's filled again from the worker's own generator,
+// which starts from its own seed so workers don't write the same stream.
+//
+type patternStream struct {
+	j      *Job
+	lcg    RandLCG
+	window []byte
+
+	// Where the current write's data starts and where the next one's will.
+	off  int
+	next int
+}
+
+func (j *Job) newPatternStream() *patternStream {
+	largest := int64(bufAlign)
+	for _, access := range j.sections {
+		if access.blkSize > largest {
+			largest = access.blkSize
+		}
+	}
+	s := &patternStream{j: j, window: alignedBuf(int(largest) + patternWindow)}
+	s.lcg.RandSeed(rand.Int63())
+	s.fill()
+	return s
+}
+
+func (s *patternStream) fill() {
+	s.j.patternFill(s.window, &s.lcg)
+	s.off, s.next = 0, 0
+}
+
+// get returns the buffer for a write of size bytes. With fresh false the data
+// of the last write is used again, as reset-buf asks for.
+func (s *patternStream) get(size int64, fresh bool) []byte {
+	if fresh {
+		s.off = s.next
+	}
+	if s.off+int(size) > len(s.window) {
+		s.fill()
+	}
+	if end := s.off + (int(size)+bufAlign-1)/bufAlign*bufAlign; end > s.next {
+		s.next = end
+	}
+	return s.window[s.off : s.off+int(size) : s.off+int(size)]
+}
@@ -0,0 +1,82 @@
+package support
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestBufPool(t *testing.T) {
+	for _, c := range []struct {
+		size  int64
+		class int
+	}{{512, 12}, {4096, 12}, {4097, 13}, {8192, 13}, {12 * 1024, 14}, {1024 * 1024, 20}} {
+		if got := sizeClass(c.size); got != c.class {
+			t.Errorf("sizeClass(%d) = %d, want %d", c.size, got, c.class)
+		}
+	}
+
+	var pool bufPool
+	w := workerBufs{pool: &pool}
+	sizes := []int64{4096, 8192, 512, 12 * 1024, 16 * 1024, 4096}
+	for _, size := range sizes {
+		b := w.get(size)
+		if int64(len(b)) != size || uintptr(unsafe.Pointer(&b[0]))%bufAlign != 0 {
+			t.Fatalf("buffer for %d is %d bytes at %p", size, len(b), &b[0])
+		}
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		for _, size := range sizes {
+			w.get(size)
+		}
+	}); n != 0 {
+		t.Errorf("%.0f allocations once the buffers exist", n)
+	}
+	if pool.Allocations() != 3 {
+		t.Errorf("%d buffers made for three size classes", pool.Allocations())
+	}
+
+	// Another worker, or the same one on the next Start(), reuses them.
+	w.release()
+	w2 := workerBufs{pool: &pool}
+	w2.get(8192)
+	w2.get(16 * 1024)
+	if pool.Allocations() != 3 {
+		t.Errorf("released buffers weren't reused, %d made", pool.Allocations())
+	}
+}
+
+func TestPatternStream(t *testing.T) {
+	j := &Job{JobParams: &JobData{Block_Pattern: PatternLCG}, sections: []AccessPattern{{blkSize: 8192}}}
+	s := j.newPatternStream()
+
+	// Every 4k written is new data, well past the point where the window is
+	// filled again, and a second worker writes something else again.
+	seen := map[string]bool{}
+	writes := 4 * len(s.window) / 4096
+	for i := 0; i < writes; i++ {
+		size := int64(4096)
+		if i%3 == 0 {
+			size = 8192
+		}
+		b := s.get(size, true)
+		if uintptr(unsafe.Pointer(&b[0]))%bufAlign != 0 {
+			t.Fatalf("write %d isn't aligned", i)
+		}
+		for off := int64(0); off < size; off += 4096 {
+			block := string(b[off : off+4096])
+			if seen[block] {
+				t.Fatalf("write %d repeats data", i)
+			}
+			seen[block] = true
+		}
+	}
+	if other := j.newPatternStream().get(4096, true); seen[string(other)] {
+		t.Errorf("two workers wrote the same data")
+	}
+
+	// Without fresh the last write's data is used again.
+	first := string(s.get(4096, true))
+	if again := string(s.get(4096, false)); again != first {
+		t.Errorf("reset-buf reuse got new data")
+	}
+}
@@ -0,0 +1,75 @@
+package support
+
+import (
+	"fmt"
+	"os"
+)
+
+//
+// CheckJob -- dry run of JobInit for fiod -check
+//
+// The target is opened read only, or not at all if it doesn't exist yet, to find
+// the size which will be used. Nothing is created or written. The effective job
+// settings are displayed along with the byte range of each access pattern section.
+//
+func CheckJob(name string, jd *JobData, printer *Printer) error {
+	path := jd.targetPath()
+	if jd.accessPattern == nil {
+		return fmt.Errorf("[%s] no access-pattern", name)
+	}
+
+	if jd.isNull() {
+		// Nothing to open, validate() made sure the job has a size.
+	} else if fp, err := os.OpenFile(path, os.O_RDONLY, 0); err == nil {
+		size, err := targetSize(fp, jd)
+		_ = fp.Close()
+		if err != nil {
+			return fmt.Errorf("[%s] %s: %s", name, path, err)
+		}
+		jd.fileSize = size
+		if fi, err := os.Stat(path); err == nil {
+			if err := guardTarget(path, fi, jd); err != nil {
+				return fmt.Errorf("[%s] %s", name, err)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("[%s] %s", name, err)
+	} else if jd.fileSize == 0 {
+		return fmt.Errorf("[%s] %s doesn't exist, must set file size or use a preexisting file", name, path)
+	}
+	jd.Size = Humanize(jd.fileSize, 1)
+	if err := jd.layoutSections(); err != nil {
+		return fmt.Errorf("[%s] %s", name, err)
+	}
+
+	printer.Send("---- [%s] ----\n", name)
+	DisplayInterface(jd, printer)
+	printer.Send("%s\n", layoutTable(jd))
+	return nil
+}
+
+func layoutTable(jd *JobData) string {
+	titles := []string{"Section", "Op", "Read%", "Block", "Start", "End"}
+	var rows [][]string
+	idx := 0
+	for e := jd.accessPattern.Front(); e != nil; e = e.Next() {
+		access := e.Value.(AccessPattern)
+		readPct := "-"
+		if access.opType == RwrandType || access.opType == RwseqType || access.opType == RwrandVerifyType {
+			readPct = fmt.Sprintf("%d", access.readPercent)
+		}
+		where := fmt.Sprintf("%d (%d%%)", idx, access.sectionPercent)
+		if access.absolute {
+			where = fmt.Sprintf("%d (@)", idx)
+		}
+		block := access.blkDesc
+		if block == "" {
+			block = "-"
+		}
+		rows = append(rows, []string{where, access.opDesc(), readPct, block,
+			fmt.Sprintf("%d", access.sectionStart), fmt.Sprintf("%d", access.sectionStart+access.weight)})
+		idx++
+	}
+
+	return FormatTable(titles, rows, 2)
+}
@@ -0,0 +1,71 @@
+package support
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fiod-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "existing")
+	if err := ioutil.WriteFile(existing, make([]byte, 2*1024*1024), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := readTestConfig(t, fmt.Sprintf(`
+[global]
+version=1
+directory=%s
+
+[job "new"]
+size=1m
+access-pattern=50:read:4k,50:randwrite:8k
+
+[job "existing"]
+name=existing
+access-pattern=100:randread:4k
+
+[job "nosize"]
+access-pattern=100:read:4k
+
+[job "outside"]
+size=1m
+access-pattern=@0-4m:read:4k
+`, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printer := PrintInit()
+	for name, want := range map[string]string{"new": "", "existing": "", "nosize": "must set file size",
+		"outside": "outside"} {
+		err := CheckJob(name, cfg.Job[name], printer)
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("[%s] %s", name, err)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Errorf("[%s] got %v, want an error about %q", name, err, want)
+		}
+	}
+
+	// The existing file's size is used and nothing is created.
+	if size := cfg.Job["existing"].fileSize; size != 2*1024*1024 {
+		t.Errorf("existing file is %d bytes", size)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("check created %d files", len(entries)-1)
+	}
+	table := layoutTable(cfg.Job["new"])
+	for _, cell := range []string{"524288", "1048576", "randwrite"} {
+		if !strings.Contains(table, cell) {
+			t.Errorf("layout doesn't show %s:\n%s", cell, table)
+		}
+	}
+}
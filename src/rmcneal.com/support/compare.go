@@ -0,0 +1,168 @@
+package support
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReadReport loads a report written by fiod -json.
+func ReadReport(filename string) (*Report, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	if err := json.Unmarshal(b, report); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return report, nil
+}
+
+// CompareThresholds are how far, as a percentage of the baseline, a job may
+// get worse before it's a regression. Throughput is worse when it drops,
+// latency when it goes up.
+type CompareThresholds struct {
+	IOPS    float64
+	BW      float64
+	Latency float64
+}
+
+// MetricDelta is the change in one number of a job.
+type MetricDelta struct {
+	Job        string
+	Metric     string
+	Baseline   float64
+	Current    float64
+	Change     float64
+	Regression bool
+	latency    bool
+}
+
+// Comparison holds every delta along with the jobs found on only one side.
+type Comparison struct {
+	Deltas  []*MetricDelta
+	Missing []string
+	Added   []string
+}
+
+// jobMetric pulls one number out of a job's results.
+type jobMetric struct {
+	name    string
+	latency bool
+	value   func(r *JobResult) float64
+}
+
+var compareMetrics = []jobMetric{
+	{"IOPS", false, func(r *JobResult) float64 { return float64(r.IOPS) }},
+	{"BW", false, func(r *JobResult) float64 { return float64(r.BW) }},
+	{"Read Lat", true, func(r *JobResult) float64 { return float64(r.ReadLatAvg) }},
+	{"Write Lat", true, func(r *JobResult) float64 { return float64(r.WriteLatAvg) }},
+	{"P50", true, func(r *JobResult) float64 { return float64(r.Latency.P50) }},
+	{"P90", true, func(r *JobResult) float64 { return float64(r.Latency.P90) }},
+	{"P99", true, func(r *JobResult) float64 { return float64(r.Latency.P99) }},
+	{"P99.9", true, func(r *JobResult) float64 { return float64(r.Latency.P999) }},
+}
+
+//
+// CompareReports -- match the jobs of current against a baseline
+//
+// Jobs are matched by name. When more than one baseline report is given each
+// metric's baseline is the average over the reports which ran that job, so a
+// set of earlier nightly runs smooths out the noise. Metrics which are zero in
+// the baseline, such as write latency for a read only job, aren't compared.
+//
+func CompareReports(baselines []*Report, current *Report, th CompareThresholds) *Comparison {
+	c := &Comparison{}
+	byName := map[string][]*JobResult{}
+	var order []string
+	for _, report := range baselines {
+		for _, r := range report.Jobs {
+			if _, ok := byName[r.Name]; !ok {
+				order = append(order, r.Name)
+			}
+			byName[r.Name] = append(byName[r.Name], r)
+		}
+	}
+	seen := map[string]bool{}
+	for _, cur := range current.Jobs {
+		seen[cur.Name] = true
+		base, ok := byName[cur.Name]
+		if !ok {
+			c.Added = append(c.Added, cur.Name)
+			continue
+		}
+		for _, m := range compareMetrics {
+			sum := 0.0
+			for _, r := range base {
+				sum += m.value(r)
+			}
+			d := &MetricDelta{Job: cur.Name, Metric: m.name, Baseline: sum / float64(len(base)),
+				Current: m.value(cur), latency: m.latency}
+			if d.Baseline == 0 {
+				continue
+			}
+			d.Change = (d.Current - d.Baseline) / d.Baseline * 100
+			switch {
+			case m.latency:
+				d.Regression = d.Change > th.Latency
+			case m.name == "BW":
+				d.Regression = -d.Change > th.BW
+			default:
+				d.Regression = -d.Change > th.IOPS
+			}
+			c.Deltas = append(c.Deltas, d)
+		}
+	}
+	for _, name := range order {
+		if !seen[name] {
+			c.Missing = append(c.Missing, name)
+		}
+	}
+	sort.Strings(c.Added)
+	return c
+}
+
+// Regressions counts the metrics which got worse by more than their threshold
+// plus the baseline jobs which weren't run.
+func (c *Comparison) Regressions() int {
+	n := len(c.Missing)
+	for _, d := range c.Deltas {
+		if d.Regression {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *MetricDelta) format(v float64) string {
+	if d.latency {
+		return time.Duration(v).String()
+	}
+	return strings.TrimSpace(Humanize(int64(v), 1))
+}
+
+// String is the table of deltas followed by any jobs which didn't match.
+func (c *Comparison) String() string {
+	titles := []string{"Job", "Metric", "Baseline", "Current", "Change", "Status"}
+	var rows [][]string
+	for _, d := range c.Deltas {
+		flag := "ok"
+		if d.Regression {
+			flag = "REGRESSION"
+		}
+		rows = append(rows, []string{d.Job, d.Metric, d.format(d.Baseline), d.format(d.Current),
+			fmt.Sprintf("%+.1f%%", d.Change), flag})
+	}
+	s := FormatTable(titles, rows, 2)
+	for _, name := range c.Missing {
+		s += fmt.Sprintf("\nREGRESSION: %s is in the baseline but wasn't run", name)
+	}
+	for _, name := range c.Added {
+		s += fmt.Sprintf("\nNew job %s has no baseline", name)
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package support
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareReports(t *testing.T) {
+	job := func(name string, iops int64, p99 time.Duration) *JobResult {
+		return &JobResult{Name: name, IOPS: iops, BW: iops * 4096, ReadLatAvg: p99 / 2,
+			Latency: LatencyPercentiles{P50: p99 / 4, P90: p99 / 2, P99: p99, P999: 2 * p99}}
+	}
+	baselines := []*Report{
+		{Jobs: []*JobResult{job("read", 10000, time.Millisecond), job("gone", 10, time.Second)}},
+		{Jobs: []*JobResult{job("read", 12000, 3*time.Millisecond)}},
+	}
+
+	// Write the current run out and read it back the way fiod-compare does.
+	dir, err := ioutil.TempDir("", "fiod-compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "current.json")
+	if err := WriteReport(name, &Report{Version: 1, Jobs: []*JobResult{job("read", 10450, 2200*time.Microsecond),
+		job("new", 5, time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+	current, err := ReadReport(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IOPS is 5% under the 11000 average and P99 is 10% over 2ms.
+	c := CompareReports(baselines, current, CompareThresholds{IOPS: 6, BW: 4, Latency: 10})
+	got := map[string]*MetricDelta{}
+	for _, d := range c.Deltas {
+		got[d.Metric] = d
+	}
+	if d := got["IOPS"]; d == nil || d.Baseline != 11000 || d.Change != -5 || d.Regression {
+		t.Errorf("IOPS: %+v", d)
+	}
+	if d := got["BW"]; d == nil || !d.Regression {
+		t.Errorf("BW: %+v", d)
+	}
+	if d := got["P99"]; d == nil || d.Regression {
+		t.Errorf("P99 at the threshold: %+v", d)
+	}
+	if d := got["Write Lat"]; d != nil {
+		t.Errorf("write latency of a read job compared: %+v", d)
+	}
+	if len(c.Missing) != 1 || c.Missing[0] != "gone" || len(c.Added) != 1 || c.Added[0] != "new" {
+		t.Errorf("missing %v, added %v", c.Missing, c.Added)
+	}
+	if n := c.Regressions(); n != 2 {
+		t.Errorf("%d regressions, wanted BW and the missing job\n%s", n, c)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"container/list"
 	"fmt"
 	"gopkg.in/gcfg.v1"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +25,15 @@ const (
 	PatternLCG    = "lcg"
 	RwrandVerify  = "rwv"
 	None          = "none"
+
+	SeqReverse   = "seqrev"
+	SeqStride    = "stride"
+	SeqPerWorker = "seq-per-worker"
+
+	SteadyIOPS      = "iops"
+	SteadyBW        = "bw"
+	SteadyIOPSSlope = "iops-slope"
+	SteadyBWSlope   = "bw-slope"
 )
 const (
 	_           = iota
@@ -39,6 +51,12 @@ const (
 	RwrandVerifyType
 	NoneType
 	StopType // Used to halt fileFill loop jobs
+	SyncType // Only used to show an fsync to the io-timeout watchdog
+)
+const (
+	_              = iota
+	SteadyIOPSType = iota + 1
+	SteadyBWType
 )
 
 //noinspection GoSnakeCaseUsage
@@ -50,30 +68,50 @@ type JobData struct {
 	 * here becomes block-pattern in the file. Changes to the name will require
 	 * config file changes.
 	 */
-	Version            int
-	Directory          string
-	Name               string
-	Block_Pattern      string
-	IODepth            int
-	Size               string
-	Runtime            string
-	Rate               int
-	Verbose            bool
-	Record_Time        string
-	Record_File        string
-	Record_Network     string
-	Graphite_Metric    string
-	Delay_Start        string
-	Barrier            bool
-	Job_Order          string
-	Fsync              int
-	Access_Pattern     string
-	Linear             string
-	Slave_Host         string
-	Intermediate_Stats string
-	Save_On_Create     bool
-	Force_Fill         bool
-	Reset_Buf          int
+	Version             int
+	Directory           string
+	Name                string
+	Block_Pattern       string
+	IODepth             int
+	Size                string
+	Runtime             string
+	Rate                int
+	Verbose             bool
+	Record_Time         string
+	Record_File         string
+	Record_Network      string
+	Graphite_Metric     string
+	Delay_Start         string
+	Barrier             bool
+	Job_Order           string
+	Fsync               int
+	Access_Pattern      string
+	Linear              string
+	Slave_Host          string
+	Intermediate_Stats  string
+	Save_On_Create      bool
+	Force_Fill          bool
+	Reset_Buf           int
+	Steady_State        string
+	Steady_State_Window int
+	Ramp_Time           string
+	Log_Interval        string
+	Log_File            string
+	Inherit             string
+	Numjobs             int
+	Random_Map          bool
+	Io_Limit            string
+	Number_Ios          int
+	Loops               int
+	Wait_For            string
+	Start_After         string
+	Assert_Min_Iops     string
+	Assert_Min_Bw       string
+	Assert_Max_Lat      string
+	Assert_Max_Errors   string
+	Io_Timeout          string
+	Io_Timeout_Abort    bool
+	Allow_Destructive   bool
 
 	// To make things easier for the user certain values
 	// in the config file need to be processed beyond
@@ -84,13 +122,44 @@ type JobData struct {
 	runtime           time.Duration
 	recordTime        time.Duration
 	delayStart        time.Duration
+	rampTime          time.Duration
+	logInterval       time.Duration
 	rateDelay         time.Duration
 	intermediateStats time.Duration
 	jobOrder          []string
 	barrierOrder      [][]string
 	accessPattern     *list.List
+	accessWeight      int64
+	ioLimit           int64
+	ioLimitScale      float64
 	linearParams      [3]time.Duration
+	startAfter        time.Duration
+	ioTimeout         time.Duration
 	doLinear          bool
+	ssMetric          int
+	ssSlope           bool
+	ssLimit           float64
+
+	// Checks made against the job's results once the run is over.
+	asserts []assertion
+
+	// Jobs which have to finish before this one starts. Built from wait-for
+	// along with job-order and barriers.
+	waitFor []string
+
+	// Options given a value in the job's section or picked up through
+	// inherit, by field name.
+	set map[string]bool
+
+	// Name of the job section in the config file. Copies made by numjobs
+	// or sweep(...) keep the name of the original.
+	section string
+
+	// Set for each job created from a sweep. sweepCreated is shared by
+	// all of the jobs from the same sweep.
+	sweepLabel   string
+	sweepLast    bool
+	sweepCreated *bool
 }
 
 var accessType map[string]int
@@ -99,6 +168,24 @@ var accessStrMap map[int]string
 type Configs struct {
 	Global JobData
 	Job    map[string]*JobData
+
+	// A [barrier] section between jobs waits for the jobs before it to
+	// complete before starting the ones after it. It has no options.
+	Barrier struct{}
+
+	// Jobs using numjobs are replaced by their copies. Used to expand the
+	// original name when found in job-order.
+	clones map[string][]string
+
+	// Same for jobs using sweep(...) except each copy gets its own barrier.
+	sweepParams map[string][]*sweepParam
+	sweeps      map[string][]string
+
+	// Where each section and option was found in the job file.
+	layout *gcfg.Layout
+
+	// Jobs which set barrier, by the name used in the file.
+	barriers map[string]bool
 }
 
 func init() {
@@ -127,17 +214,30 @@ func init() {
 func ReadConfig(filename string) (*Configs, error) {
 	var err error
 
+	var src []byte
+	var text string
+
 	cfg := &Configs{}
 
-	if err = gcfg.ReadFileInto(cfg, filename); err != nil {
+	if src, err = ioutil.ReadFile(filename); err != nil {
 		return nil, err
 	}
-
-	if err := cfg.validateGlobal(); err != nil {
+	if text, cfg.sweepParams, err = extractSweeps(filename, src); err != nil {
 		return nil, err
 	}
-	if err := cfg.UpdateJobs(); err != nil {
-		return nil, err
+
+	// Keep going after problems so that everything wrong with the file
+	// is reported at once.
+	var errs ConfigErrors
+	cfg.layout, err = gcfg.ReadStringIntoLayout(cfg, filename, text)
+	errs.append(err)
+	errs.append(cfg.expandJobs())
+	errs.append(cfg.validateGlobal())
+	errs.append(cfg.UpdateJobs())
+	if len(errs) != 0 {
+		cfg.locate(errs)
+		errs.sort()
+		return nil, errs.unique()
 	}
 	return cfg, nil
 }
@@ -146,6 +246,16 @@ func (j *JobData) GetRuntime() time.Duration {
 	return j.runtime
 }
 
+// GetWaitFor returns the jobs which have to finish before this one can start.
+func (j *JobData) GetWaitFor() []string {
+	return j.waitFor
+}
+
+// GetStartAfter is how long the job waits once the jobs it waits for are done.
+func (j *JobData) GetStartAfter() time.Duration {
+	return j.startAfter
+}
+
 func (c *Configs) GetJobsList() *[]string {
 	return &c.Global.jobOrder
 }
@@ -209,6 +319,40 @@ type AccessPattern struct {
 	// underlying storage has been opened and it's size determined
 	sectionStart int64
 	sectionEnd   int64
+
+	// Sections given as @<start>-<end> use these offsets instead of
+	// sectionPercent.
+	absolute bool
+	absStart int64
+	absEnd   int64
+
+	// Block size distribution when more than one size or a range of sizes
+	// is used. blkSize is then the largest size that will be picked.
+	blkSizes []blkSizeRange
+	blkDesc  string
+
+	// Number of bytes covered by the section once it's been laid out. Sections
+	// are picked in proportion to their size.
+	weight int64
+
+	// Sequential access modifiers. reverse works from the end of the section
+	// toward the start, stride is the number of bytes skipped between I/Os,
+	// and perWorker gives each worker its own stream in its own part of the
+	// section.
+	reverse   bool
+	stride    int64
+	perWorker bool
+
+	// Used by random sections when random-map is set.
+	randMap *blockMap
+}
+
+// blkSizeRange is one entry in a block size distribution. Sizes are picked
+// evenly between min and max in 512 byte steps.
+type blkSizeRange struct {
+	min     int64
+	max     int64
+	percent int
 }
 
 //
@@ -217,23 +361,38 @@ type AccessPattern struct {
 // <SectionSize>:<Operation>[|<readPercent>]:<BlockSize>[,]
 //
 // The <SectionSize> is the percentage of the volume that this tuple will work on. Tuples start
-// at 0, are additive, and can't add up to more than 100.
+// at 0, are additive, and can't add up to more than 100. <SectionSize> can also be an absolute
+// byte range, @<start>-<end>, such as @0-10g. Absolute ranges don't count against the 100
+// percent and can be anywhere on the target.
 //
 // <Operation> is one of read, write, rw, randread, randwrite, or rwseq. If the <Operation> is
 // followed by an optional '|' and an integer the value will be the percentage of Reads in the given
-// area.
+// area. Sequential operations can be followed by one or more '+' modifiers: +seqrev works backwards
+// through the section, +stride=<n> skips n bytes between each I/O, and +seq-per-worker gives each
+// worker its own sequential stream in its own part of the section.
 //
-// <BlockSize> used for I/O.
+// <BlockSize> used for I/O. A range, 4k-128k, picks a size between the two for each I/O. A
+// distribution, 4k/50,8k/30,64k/20, picks each size the given percentage of the time. The
+// entries of a distribution can be ranges as well and the percentages must add up to 100.
 //
 // Each tuple can be followed by an optional ',' indicated more to follow.
 //
 func (j *JobData) parseAccessPattern() error {
 	var ok bool
+	var err error
 	total := 0
+	absolute := false
 	l := list.New()
-	sections := strings.Split(j.Access_Pattern, ",")
-	if len(sections) == 0 {
-		sections = []string{j.Access_Pattern}
+
+	// A ',' also separates the entries of a block size distribution. Those
+	// pieces don't have a ':' and belong to the tuple before them.
+	var sections []string
+	for _, piece := range strings.Split(j.Access_Pattern, ",") {
+		if !strings.Contains(piece, ":") && len(sections) != 0 {
+			sections[len(sections)-1] += "," + piece
+		} else {
+			sections = append(sections, piece)
+		}
 	}
 	for _, sec := range sections {
 		params := strings.Split(sec, ":")
@@ -241,8 +400,20 @@ func (j *JobData) parseAccessPattern() error {
 			return fmt.Errorf("should be tuple of 3 '%s'", sec)
 		} else {
 			e := AccessPattern{}
-			e.sectionPercent, _ = strconv.Atoi(params[0])
-			total += e.sectionPercent
+			if strings.HasPrefix(params[0], "@") {
+				if e.absStart, e.absEnd, ok = parseSizeRange(params[0][1:]); !ok || e.absEnd <= e.absStart {
+					return fmt.Errorf("invalid range %s", params[0])
+				}
+				e.absolute = true
+				absolute = true
+			} else {
+				if e.sectionPercent, err = strconv.Atoi(params[0]); err != nil || e.sectionPercent <= 0 {
+					return fmt.Errorf("invalid section size %s", params[0])
+				}
+				total += e.sectionPercent
+			}
+			mods := strings.Split(params[1], "+")
+			params[1] = mods[0]
 			rwPercentage := strings.Split(params[1], "|")
 			if len(rwPercentage) == 1 {
 				if e.opType, ok = accessType[params[1]]; !ok {
@@ -255,9 +426,13 @@ func (j *JobData) parseAccessPattern() error {
 				}
 				e.readPercent, _ = strconv.Atoi(rwPercentage[1])
 			}
-			if e.blkSize, ok = BlkStringToInt64(params[2]); !ok {
-				return fmt.Errorf("invalid blksize: %s", params[2])
+			if err = e.parseModifiers(mods[1:]); err != nil {
+				return err
+			}
+			if e.blkSize, e.blkSizes, err = parseBlkSizes(params[2]); err != nil {
+				return err
 			}
+			e.blkDesc = params[2]
 			l.PushBack(e)
 		}
 	}
@@ -265,7 +440,7 @@ func (j *JobData) parseAccessPattern() error {
 		//noinspection GoPlaceholderCount
 		return fmt.Errorf("more than 100%")
 	}
-	if total < 100 {
+	if total < 100 && !absolute {
 		e := AccessPattern{sectionPercent: 100 - total, opType: NoneType, blkSize: 0, readPercent: 0,
 			lastBlk: 0, sectionStart: 0, sectionEnd: 0}
 		l.PushBack(e)
@@ -274,26 +449,289 @@ func (j *JobData) parseAccessPattern() error {
 	return nil
 }
 
+// parseModifiers handles the '+' options which follow a sequential operation.
+func (ap *AccessPattern) parseModifiers(mods []string) error {
+	if len(mods) == 0 {
+		return nil
+	}
+	switch ap.opType {
+	case ReadSeqType, WriteSeqType, RwseqType, ReadSeqVerifyType:
+	default:
+		return fmt.Errorf("+%s only works with sequential operations", mods[0])
+	}
+	for _, mod := range mods {
+		var ok bool
+		switch {
+		case mod == SeqReverse:
+			ap.reverse = true
+		case mod == SeqPerWorker:
+			ap.perWorker = true
+		case strings.HasPrefix(mod, SeqStride+"="):
+			if ap.stride, ok = BlkStringToInt64(strings.TrimPrefix(mod, SeqStride+"=")); !ok || ap.stride < 0 {
+				return fmt.Errorf("invalid stride %s", mod)
+			}
+		default:
+			return fmt.Errorf("unknown modifier +%s", mod)
+		}
+	}
+	return nil
+}
+
+func (ap *AccessPattern) isRandom() bool {
+	switch ap.opType {
+	case ReadRandType, WriteRandType, RwrandType, RwrandVerifyType:
+		return true
+	}
+	return false
+}
+
+// opDesc is the operation along with any modifiers as given in the job file.
+func (ap *AccessPattern) opDesc() string {
+	desc := apOpTypeToString(ap.opType)
+	if ap.reverse {
+		desc += "+" + SeqReverse
+	}
+	if ap.stride != 0 {
+		desc += fmt.Sprintf("+%s=%d", SeqStride, ap.stride)
+	}
+	if ap.perWorker {
+		desc += "+" + SeqPerWorker
+	}
+	return desc
+}
+
+// nextSeq returns the offset of the next sequential I/O of size bytes between
+// start and end. cursor is where the previous I/O left off.
+func (ap *AccessPattern) nextSeq(cursor *int64, start, end, size int64) int64 {
+	if ap.reverse {
+		off := *cursor - size
+		if off < start {
+			off = end - size
+		}
+		*cursor = off - ap.stride
+		return off
+	}
+	off := *cursor
+	if off+size > end {
+		off = start
+	}
+	*cursor = off + size + ap.stride
+	return off
+}
+
+// workerRegion is the part of the section used by one worker for +seq-per-worker.
+func (ap *AccessPattern) workerRegion(workId, workers int) (int64, int64) {
+	size := ap.weight / int64(workers) &^ 511
+	start := ap.sectionStart + int64(workId)*size
+	return start, start + size
+}
+
+// parseSizeRange converts <start>-<end> where both sizes can have a k, m, g, or t suffix.
+func parseSizeRange(s string) (int64, int64, bool) {
+	r := strings.Split(s, "-")
+	if len(r) != 2 {
+		return 0, 0, false
+	}
+	start, ok1 := BlkStringToInt64(r[0])
+	end, ok2 := BlkStringToInt64(r[1])
+	return start, end, ok1 && ok2
+}
+
+// parseBlkSizes returns the largest block size and, unless a single fixed size is
+// used, the distribution to pick sizes from.
+func parseBlkSizes(s string) (int64, []blkSizeRange, error) {
+	if !strings.ContainsAny(s, ",/-") {
+		size, ok := BlkStringToInt64(s)
+		if !ok || size <= 0 {
+			return 0, nil, fmt.Errorf("invalid blksize: %s", s)
+		}
+		return size, nil, nil
+	}
+
+	entries := strings.Split(s, ",")
+	var sizes []blkSizeRange
+	largest := int64(0)
+	total := 0
+	for _, entry := range entries {
+		var ok bool
+		var err error
+		b := blkSizeRange{percent: 100}
+		parts := strings.Split(entry, "/")
+		if len(parts) > 2 || (len(parts) == 1 && len(entries) > 1) {
+			return 0, nil, fmt.Errorf("invalid blksize: %s, should be <size>/<percent>", entry)
+		}
+		if len(parts) == 2 {
+			if b.percent, err = strconv.Atoi(parts[1]); err != nil || b.percent <= 0 {
+				return 0, nil, fmt.Errorf("invalid blksize percentage: %s", entry)
+			}
+		}
+		if strings.Contains(parts[0], "-") {
+			if b.min, b.max, ok = parseSizeRange(parts[0]); !ok || b.max < b.min {
+				return 0, nil, fmt.Errorf("invalid blksize range: %s", parts[0])
+			}
+		} else if b.min, ok = BlkStringToInt64(parts[0]); !ok {
+			return 0, nil, fmt.Errorf("invalid blksize: %s", parts[0])
+		} else {
+			b.max = b.min
+		}
+		if b.min <= 0 {
+			return 0, nil, fmt.Errorf("invalid blksize: %s", parts[0])
+		}
+		if b.max > largest {
+			largest = b.max
+		}
+		total += b.percent
+		sizes = append(sizes, b)
+	}
+	if total != 100 {
+		return 0, nil, fmt.Errorf("blksize percentages add up to %d instead of 100", total)
+	}
+	return largest, sizes, nil
+}
+
+// nextBlkSize picks the size of the next I/O for this section.
+func (ap *AccessPattern) nextBlkSize(rnd *rand.Rand) int64 {
+	if ap.blkSizes == nil {
+		return ap.blkSize
+	}
+	b := ap.blkSizes[len(ap.blkSizes)-1]
+	pick := rnd.Intn(100)
+	for _, bs := range ap.blkSizes {
+		if pick < bs.percent {
+			b = bs
+			break
+		}
+		pick -= bs.percent
+	}
+	if b.max-b.min < 512 {
+		return b.min
+	}
+	return b.min + rnd.Int63n((b.max-b.min)/512+1)*512
+}
+
+// layoutSections computes the byte range of each access pattern section. Can only
+// be called once the size of the target is known.
+func (j *JobData) layoutSections() error {
+	currentBlk := int64(0)
+	j.accessWeight = 0
+	idx := 0
+	for e := j.accessPattern.Front(); e != nil; e = e.Next() {
+		access := e.Value.(AccessPattern)
+		var end int64
+		if access.absolute {
+			if access.absEnd > j.fileSize {
+				return fmt.Errorf("access-pattern range @%d-%d is beyond the end of the target (%d bytes)",
+					access.absStart, access.absEnd, j.fileSize)
+			}
+			access.sectionStart = access.absStart
+			end = access.absEnd
+		} else {
+			access.sectionStart = currentBlk
+			currentBlk += j.fileSize * int64(access.sectionPercent) / 100
+			end = currentBlk
+		}
+		access.lastBlk = access.sectionStart
+		if access.reverse {
+			access.lastBlk = end
+		}
+		access.sectionEnd = end - access.blkSize
+		access.weight = end - access.sectionStart
+		if access.opType != NoneType && access.weight < 2*access.blkSize+512 {
+			return fmt.Errorf("access-pattern section %d is too small (%d bytes) for block size %s",
+				idx, access.weight, access.blkDesc)
+		}
+		if j.Random_Map && access.isRandom() {
+			if access.blkSizes != nil {
+				return fmt.Errorf("access-pattern section %d must use a single block size with random-map", idx)
+			}
+			access.randMap = newBlockMap(access.weight / access.blkSize)
+		}
+		if access.perWorker && j.IODepth > 0 {
+			if start, end := access.workerRegion(0, j.IODepth); end-start < access.blkSize {
+				return fmt.Errorf("access-pattern section %d is too small to split between %d workers",
+					idx, j.IODepth)
+			}
+		}
+		j.accessWeight += access.weight
+		e.Value = access
+		idx++
+	}
+	if j.accessWeight == 0 {
+		return fmt.Errorf("access-pattern doesn't cover any of the target")
+	}
+	if j.ioLimitScale > 0 {
+		j.ioLimit = int64(j.ioLimitScale * float64(j.fileSize))
+	}
+	return nil
+}
+
+func (j *JobData) isNull() bool {
+	return j.Name == NullTarget
+}
+
+// limited is true if the job has io-limit, number-ios, or loops set.
+func (j *JobData) limited() bool {
+	return j.Number_Ios > 0 || j.ioLimit > 0 || j.Loops > 0
+}
+
+// limitReached returns which of io-limit or number-ios has been met once ios
+// requests totalling bytes have been issued, or StopNone. loops is counted for
+// each section by the job.
+func (j *JobData) limitReached(ios, bytes int64) StopReason {
+	switch {
+	case j.Number_Ios > 0 && ios >= int64(j.Number_Ios):
+		return StopNumberIOs
+	case j.ioLimit > 0 && bytes >= j.ioLimit:
+		return StopIOLimit
+	}
+	return StopNone
+}
+
+// parseIOLimit accepts a size such as 100g or a multiple of the target size
+// such as 2x. The multiple is resolved once the size is known.
+func (j *JobData) parseIOLimit() error {
+	if strings.HasSuffix(j.Io_Limit, "x") {
+		scale, err := strconv.ParseFloat(strings.TrimSuffix(j.Io_Limit, "x"), 64)
+		if err != nil || scale <= 0 {
+			return fmt.Errorf("multiple must be a positive number")
+		}
+		j.ioLimitScale = scale
+		return nil
+	}
+	size, ok := BlkStringToInt64(j.Io_Limit)
+	if !ok || size <= 0 {
+		return fmt.Errorf("must be a size or a multiple of the target size like 2x")
+	}
+	j.ioLimit = size
+	return nil
+}
+
+//
+// validate -- check each option and convert it to the value used during a run
+//
+// Defaults are filled in for options which weren't set. Every problem found is
+// returned as a ConfigErrors list.
+//
 func (j *JobData) validate(section string) error {
+	var errs ConfigErrors
 	var err error
 	if j.Access_Pattern != "" {
 		if err = j.parseAccessPattern(); err != nil {
-			return fmt.Errorf("[%s] contains invalid access pattern '%s', specific portion '%s'", section, j.Access_Pattern, err)
+			errs.add(section, "access-pattern", "invalid access pattern '%s', specific portion '%s'",
+				j.Access_Pattern, err)
 		}
 	}
 	if j.Name, err = EnvStrReplace(j.Name); err != nil {
-		return err
+		errs.add(section, "name", "%s", err)
 	}
 	if j.Directory != "" {
 		var fi os.FileInfo
 		if j.Directory, err = EnvStrReplace(j.Directory); err != nil {
-			return err
-		}
-		if fi, err = os.Stat(j.Directory); err != nil {
-			return fmt.Errorf("[%s] %s doesn't exist [%s]", section, j.Directory, err)
-		}
-		if fi.Mode().IsDir() != true {
-			return fmt.Errorf("[%s] %s exists, but isn't a directory", section, j.Directory)
+			errs.add(section, "directory", "%s", err)
+		} else if fi, err = os.Stat(j.Directory); err != nil {
+			errs.add(section, "directory", "%s doesn't exist [%s]", j.Directory, err)
+		} else if fi.Mode().IsDir() != true {
+			errs.add(section, "directory", "%s exists, but isn't a directory", j.Directory)
 		}
 	} else {
 		j.Directory = "./"
@@ -309,7 +747,20 @@ func (j *JobData) validate(section string) error {
 	var ok bool
 
 	if j.fileSize, ok = BlkStringToInt64(j.Size); !ok {
-		return fmt.Errorf("[second %s]/file-size: %s", section, j.Size)
+		errs.add(section, "size", "invalid size %s", j.Size)
+	}
+	if j.isNull() {
+		if j.fileSize == 0 {
+			errs.add(section, "size", "must be set for the null target")
+		}
+		if j.accessPattern != nil {
+			for e := j.accessPattern.Front(); e != nil; e = e.Next() {
+				switch e.Value.(AccessPattern).opType {
+				case ReadSeqVerifyType, RwrandVerifyType:
+					errs.add(section, "access-pattern", "verify operations can't be used with the null target")
+				}
+			}
+		}
 	}
 
 	if j.Runtime == "" {
@@ -322,14 +773,12 @@ func (j *JobData) validate(section string) error {
 		daysStr := strings.TrimSuffix(j.Runtime, "d")
 		if numberOfDays, err := strconv.ParseInt(daysStr, 0, 32); err == nil {
 			j.Runtime = fmt.Sprintf("%dh", numberOfDays * 24)
-		} else {
-			return err
 		}
 	}
 	if dur, err := time.ParseDuration(j.Runtime); err == nil {
 		j.runtime = dur
 	} else {
-		return err
+		errs.add(section, "runtime", "invalid runtime value %s", j.Runtime)
 	}
 
 	if j.Rate != 0 {
@@ -342,15 +791,14 @@ func (j *JobData) validate(section string) error {
 	switch j.Block_Pattern {
 	case PatternRand, PatternLCG:
 	default:
-		return fmt.Errorf("[section %s]/Invalid pattern %s", section,
-			j.Block_Pattern)
+		errs.add(section, "block-pattern", "invalid pattern %s", j.Block_Pattern)
 	}
 
 	if j.Record_Time == "" {
 		j.Record_Time = "5s"
 	}
 	if dur, err := time.ParseDuration(j.Record_Time); err != nil {
-		return fmt.Errorf("[section %s]/Invalid record-time value\n", section)
+		errs.add(section, "record-time", "invalid record-time value %s", j.Record_Time)
 	} else {
 		j.recordTime = dur
 	}
@@ -367,11 +815,27 @@ func (j *JobData) validate(section string) error {
 		j.Delay_Start = "0s"
 	}
 	if dur, err := time.ParseDuration(j.Delay_Start); err != nil {
-		//noinspection GoPlaceholderCount
-		return fmt.Errorf("[section %s]/Invalid delay-start value\n", section)
+		errs.add(section, "delay-start", "invalid delay-start value %s", j.Delay_Start)
 	} else {
 		j.delayStart = dur
 	}
+
+	if j.Start_After != "" {
+		if dur, err := time.ParseDuration(j.Start_After); err != nil || dur < 0 {
+			errs.add(section, "start-after", "invalid start-after value %s", j.Start_After)
+		} else {
+			j.startAfter = dur
+		}
+	}
+
+	if j.Ramp_Time == "" {
+		j.Ramp_Time = "0s"
+	}
+	if dur, err := time.ParseDuration(j.Ramp_Time); err != nil {
+		errs.add(section, "ramp-time", "invalid ramp-time value %s", j.Ramp_Time)
+	} else {
+		j.rampTime = dur
+	}
 	if j.Slave_Host == "" {
 		j.Slave_Host = "127.0.0.1"
 	}
@@ -379,22 +843,100 @@ func (j *JobData) validate(section string) error {
 	if j.Reset_Buf == 0 {
 		j.Reset_Buf = 10000
 	}
+
+	if j.Log_Interval != "" {
+		if dur, err := time.ParseDuration(j.Log_Interval); err != nil || dur <= 0 {
+			errs.add(section, "log-interval", "invalid log-interval value %s", j.Log_Interval)
+		} else {
+			j.logInterval = dur
+		}
+	}
+
+	if j.Steady_State != "" {
+		if err = j.parseSteadyState(); err != nil {
+			errs.add(section, "steady-state", "invalid steady-state '%s': %s", j.Steady_State, err)
+		}
+	}
+	if j.Steady_State_Window == 0 {
+		j.Steady_State_Window = 5
+	} else if j.Steady_State_Window < 2 {
+		errs.add(section, "steady-state-window", "must be at least 2 samples")
+	}
+
+	if j.Io_Limit != "" {
+		if err = j.parseIOLimit(); err != nil {
+			errs.add(section, "io-limit", "invalid io-limit '%s': %s", j.Io_Limit, err)
+		}
+	}
+	errs.append(j.parseAssertions(section))
+
+	if j.Io_Timeout != "" {
+		if dur, err := time.ParseDuration(j.Io_Timeout); err != nil || dur <= 0 {
+			errs.add(section, "io-timeout", "invalid io-timeout value %s", j.Io_Timeout)
+		} else {
+			j.ioTimeout = dur
+		}
+	} else if j.Io_Timeout_Abort {
+		errs.add(section, "io-timeout-abort", "requires io-timeout")
+	}
+
+	if j.Number_Ios < 0 {
+		errs.add(section, "number-ios", "can't be negative")
+	}
+	if j.Loops < 0 {
+		errs.add(section, "loops", "can't be negative")
+	}
+	return errs.err()
+}
+
+//
+// parseSteadyState -- convert the steady-state option into the metric and limit to watch
+//
+// <Metric>:<Limit>[%]
+//
+// <Metric> is one of iops, bw, iops-slope, or bw-slope. The plain metrics require the
+// difference between the largest and smallest sample in the window to be within <Limit>
+// percent of the window average. The slope variants require the excursion of the best
+// fit line across the window to be within <Limit> percent of the average. These match
+// the SNIA PTS steady state criteria.
+//
+func (j *JobData) parseSteadyState() error {
+	params := strings.Split(j.Steady_State, ":")
+	if len(params) != 2 {
+		return fmt.Errorf("should be <metric>:<limit>%%")
+	}
+	switch params[0] {
+	case SteadyIOPS, SteadyIOPSSlope:
+		j.ssMetric = SteadyIOPSType
+	case SteadyBW, SteadyBWSlope:
+		j.ssMetric = SteadyBWType
+	default:
+		return fmt.Errorf("unknown metric %s", params[0])
+	}
+	j.ssSlope = strings.HasSuffix(params[0], "-slope")
+	limit, err := strconv.ParseFloat(strings.TrimSuffix(params[1], "%"), 64)
+	if err != nil || limit <= 0 {
+		return fmt.Errorf("invalid limit %s", params[1])
+	}
+	j.ssLimit = limit
 	return nil
 }
 
 func (c *Configs) validateGlobal() error {
+	var errs ConfigErrors
 	if c.Global.Version != 1 {
-		return fmt.Errorf("invalid configuration file 'version'. valid config version is 1")
+		errs.add("global", "version", "invalid configuration file 'version'. valid config version is 1")
 	}
 	if c.Global.Linear != "" {
 		vals := strings.Split(c.Global.Linear, ",")
 		if len(vals) != 3 {
-			return fmt.Errorf("invalid Linear configuration (min, max, increment)")
-		}
-		for idx, val := range vals {
-			c.Global.linearParams[idx], _ = time.ParseDuration(strings.TrimSpace(val))
+			errs.add("global", "linear", "invalid Linear configuration (min, max, increment)")
+		} else {
+			for idx, val := range vals {
+				c.Global.linearParams[idx], _ = time.ParseDuration(strings.TrimSpace(val))
+			}
+			c.Global.doLinear = true
 		}
-		c.Global.doLinear = true
 	} else {
 		c.Global.doLinear = false
 	}
@@ -402,93 +944,249 @@ func (c *Configs) validateGlobal() error {
 		c.Global.intermediateStats = 0
 	} else {
 		if dur, err := time.ParseDuration(c.Global.Intermediate_Stats); err != nil {
-			return fmt.Errorf("invalid intermediate-stats value: %s", c.Global.Intermediate_Stats)
+			errs.add("global", "intermediate-stats", "invalid intermediate-stats value: %s",
+				c.Global.Intermediate_Stats)
 		} else {
 			c.Global.intermediateStats = dur
 		}
 	}
+	var order []string
 	if c.Global.Job_Order == "" {
-		var barrierList []string = nil
-		for name := range c.Job {
-			barrierList = append(barrierList, name)
-			c.Global.jobOrder = append(c.Global.jobOrder, name)
-		}
-		c.Global.barrierOrder = append(c.Global.barrierOrder, barrierList)
+		order = c.fileOrder()
 	} else {
-		var barrierList []string = nil
-		for _, name := range strings.FieldsFunc(c.Global.Job_Order, FindComma) {
-			name = strings.TrimSpace(name)
-			if _, ok := c.Job[name]; ok {
-				barrierList = append(barrierList, name)
-			} else if name == "barrier" {
+		order = strings.FieldsFunc(c.Global.Job_Order, FindComma)
+	}
+	var barrierList []string = nil
+	for _, name := range order {
+		name = strings.TrimSpace(name)
+		if c.barriers[name] && len(barrierList) != 0 {
+			c.Global.barrierOrder = append(c.Global.barrierOrder, barrierList)
+			barrierList = nil
+		}
+		if _, ok := c.sweeps[name]; ok {
+			if len(barrierList) != 0 {
 				c.Global.barrierOrder = append(c.Global.barrierOrder, barrierList)
-				barrierList = nil
-			} else {
-				return fmt.Errorf("unknown job [%s]", name)
 			}
-			c.Global.jobOrder = append(c.Global.jobOrder, name)
+			c.Global.barrierOrder = c.appendSweeps(c.Global.barrierOrder, []string{name})
+			barrierList = nil
+			continue
+		} else if copies, ok := c.clones[name]; ok {
+			barrierList = append(barrierList, copies...)
+			c.Global.jobOrder = append(c.Global.jobOrder, copies...)
+			continue
+		} else if _, ok := c.Job[name]; ok {
+			barrierList = append(barrierList, name)
+		} else if name == "barrier" {
+			if len(barrierList) != 0 {
+				c.Global.barrierOrder = append(c.Global.barrierOrder, barrierList)
+			}
+			barrierList = nil
+			continue
+		} else {
+			errs.add("global", "job-order", "unknown job [%s]", name)
+			continue
 		}
+		c.Global.jobOrder = append(c.Global.jobOrder, name)
+	}
+	if len(barrierList) != 0 || len(c.Global.barrierOrder) == 0 {
 		c.Global.barrierOrder = append(c.Global.barrierOrder, barrierList)
 	}
+	if len(errs) == 0 {
+		errs.append(c.buildDependencies())
+	}
 
-	return c.Global.validate("global")
+	errs.append(c.Global.validate("global"))
+	return errs.err()
 }
 
-func (c *Configs) UpdateJobs() error {
-	// There's got to be better way to scan through the elements of JobData.
-	// Considering that gcfg does something like that need to look.
-	for jobName, jd := range c.Job {
-		if jd.Directory == "" {
-			jd.Directory = c.Global.Directory
-		}
-		if jd.Name == "" {
-			jd.Name = c.Global.Name + jobName
-		}
-		if jd.IODepth == 0 {
-			jd.IODepth = c.Global.IODepth
-		}
-		if jd.Size == "" {
-			jd.Size = c.Global.Size
-		}
-		if jd.Runtime == "" {
-			jd.Runtime = c.Global.Runtime
+// fileOrder lists the jobs in the order they appear in the job file with
+// "barrier" wherever a [barrier] section is found.
+func (c *Configs) fileOrder() []string {
+	var order []string
+	seen := map[string]bool{}
+	for _, s := range c.layout.Sections {
+		switch strings.ToLower(s.Section) {
+		case "barrier":
+			order = append(order, "barrier")
+		case "job":
+			if !seen[s.Subsection] {
+				seen[s.Subsection] = true
+				order = append(order, s.Subsection)
+			}
 		}
-		if jd.Rate == 0 {
-			jd.Rate = c.Global.Rate
+	}
+	return order
+}
+
+// noInherit are the options which are never copied into a job from either the
+// [global] section or the job named by inherit. Verbose is specific to each
+// section and every job needs its own log-file. Name isn't copied either so
+// two jobs never share, and remove, the same target. A job without a name
+// uses the [global] name followed by the job name as usual.
+var noInherit = map[string]bool{
+	"Version":  true,
+	"Inherit":  true,
+	"Numjobs":  true,
+	"Barrier":  true,
+	"Verbose":  true,
+	"Log_File": true,
+	"Name":     true,
+}
+
+// noGlobalInherit are only skipped when copying from [global]. A wait-for in
+// [global] would have every job waiting on itself.
+var noGlobalInherit = map[string]bool{
+	"Fsync":    true,
+	"Wait_For": true,
+}
+
+// markSet records the options given a value in the section. Testing for a
+// zero value instead would mean an inherited option could never be set back
+// to false or 0.
+func (j *JobData) markSet(layout *gcfg.Layout, sect, sub string) {
+	j.set = map[string]bool{}
+	t := reflect.TypeOf(*j)
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Name; layout.Var(sect, sub, name) != nil {
+			j.set[name] = true
 		}
-		if jd.Record_Time == "" {
-			jd.Record_Time = c.Global.Record_Time
+	}
+}
+
+// inherit copies every option set in parent which hasn't been set in j. The
+// options copied count as set in j so they're passed on to any job which
+// inherits from j in turn.
+func (j *JobData) inherit(parent *JobData, skip map[string]bool) {
+	dst := reflect.ValueOf(j).Elem()
+	src := reflect.ValueOf(parent).Elem()
+	set := map[string]bool{}
+	for name := range j.set {
+		set[name] = true
+	}
+	for i := 0; i < dst.NumField(); i++ {
+		name := dst.Type().Field(i).Name
+		f := dst.Field(i)
+		if !f.CanSet() || noInherit[name] || skip[name] || set[name] || !parent.set[name] {
+			continue
 		}
-		if jd.Record_File == "" {
-			jd.Record_File = c.Global.Record_File
+		f.Set(src.Field(i))
+		set[name] = true
+	}
+	j.set = set
+}
+
+//
+// expandJobs -- resolve inherit and numjobs before anything else looks at the jobs
+//
+// A job with inherit=<job> picks up every option it doesn't set from the named job,
+// which may itself inherit from another. Jobs using sweep(...) are then replaced by
+// one job per combination. Finally, a job with numjobs=N is replaced by N copies
+// named <job>.0 through <job>.N-1 and "$jobnum" in the name option is replaced by the
+// copy number.
+//
+func (c *Configs) expandJobs() error {
+	c.barriers = map[string]bool{}
+	c.Global.markSet(c.layout, "global", "")
+	for name, jd := range c.Job {
+		jd.section = name
+		jd.markSet(c.layout, "job", name)
+		c.barriers[name] = jd.Barrier
+	}
+	resolved := map[string]bool{}
+	var resolve func(name string, seen map[string]bool) error
+	resolve = func(name string, seen map[string]bool) error {
+		jd := c.Job[name]
+		if resolved[name] || jd.Inherit == "" {
+			return nil
 		}
-		if jd.Graphite_Metric == "" {
-			jd.Graphite_Metric = c.Global.Graphite_Metric
+		if seen[name] {
+			return optionError(name, "inherit", "inherit loop")
 		}
-		if jd.Record_Network == "" {
-			jd.Record_Network = c.Global.Record_Network
+		seen[name] = true
+		parent, ok := c.Job[jd.Inherit]
+		if !ok {
+			return optionError(name, "inherit", "inherit from unknown job [%s]", jd.Inherit)
 		}
-		if jd.Delay_Start == "" {
-			jd.Delay_Start = c.Global.Delay_Start
+		if err := resolve(jd.Inherit, seen); err != nil {
+			return err
 		}
-		if jd.Job_Order == "" {
-			jd.Job_Order = c.Global.Job_Order
+		jd.inherit(parent, nil)
+		resolved[name] = true
+		return nil
+	}
+	var errs ConfigErrors
+	for name := range c.Job {
+		errs.append(resolve(name, map[string]bool{}))
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+
+	if err := c.expandSweeps(); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range c.Job {
+		names = append(names, name)
+	}
+	c.clones = map[string][]string{}
+	for _, name := range names {
+		jd := c.Job[name]
+		count := c.numjobs(jd)
+		if count < 0 {
+			return optionError(name, "numjobs", "invalid numjobs %d", count)
 		}
-		if jd.Slave_Host == "" {
-			jd.Slave_Host = c.Global.Slave_Host
+		if count <= 1 {
+			// A single copy is number 0 so that uncommenting numjobs
+			// doesn't change the file used.
+			jd.Name = strings.Replace(jd.Name, "$jobnum", "0", -1)
+			continue
 		}
-		if jd.Access_Pattern == "" {
-			jd.Access_Pattern = c.Global.Access_Pattern
+		delete(c.Job, name)
+		for n := 0; n < count; n++ {
+			clone := *jd
+			clone.Numjobs = 1
+			clone.Name = strings.Replace(clone.Name, "$jobnum", strconv.Itoa(n), -1)
+			cloneName := fmt.Sprintf("%s.%d", name, n)
+			c.Job[cloneName] = &clone
+			c.clones[name] = append(c.clones[name], cloneName)
 		}
-		if jd.Reset_Buf == 0 {
-			jd.Reset_Buf = c.Global.Reset_Buf
+	}
+	return nil
+}
+
+// numjobs is the number of copies of the job to run, from the job or [global].
+func (c *Configs) numjobs(jd *JobData) int {
+	if jd.Numjobs == 0 {
+		return c.Global.Numjobs
+	}
+	return jd.Numjobs
+}
+
+// appendSweeps adds a barrier for each job created by the named sweeps.
+func (c *Configs) appendSweeps(order [][]string, sweepList []string) [][]string {
+	for _, name := range sweepList {
+		for _, sweepName := range c.sweeps[name] {
+			names := []string{sweepName}
+			if copies, ok := c.clones[sweepName]; ok {
+				names = copies
+			}
+			order = append(order, names)
+			c.Global.jobOrder = append(c.Global.jobOrder, names...)
 		}
-		// -- Don't copy Verbose from the global settings to each job. Verbose
-		// is specific to each section.
-		// -- Same with fsync.
-		if err := jd.validate(jobName); err != nil {
-			return err
+	}
+	return order
+}
+
+func (c *Configs) UpdateJobs() error {
+	var errs ConfigErrors
+	for jobName, jd := range c.Job {
+		if jd.Name == "" {
+			jd.Name = c.Global.Name + jobName
 		}
+		jd.inherit(&c.Global, noGlobalInherit)
+		errs.append(jd.validate(jobName))
 	}
-	return nil
+	return errs.err()
 }
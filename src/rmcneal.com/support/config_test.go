@@ -0,0 +1,475 @@
+package support
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readTestConfig(t testing.TB, body string) (*Configs, error) {
+	dir, err := ioutil.TempDir("", "fiod-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.j")
+	if err := ioutil.WriteFile(name, []byte(body), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return ReadConfig(name)
+}
+
+func TestInheritAndNumjobs(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+runtime=1m
+iodepth=4
+
+[job "base"]
+access-pattern=100:randread:4k
+size=1g
+fsync=8
+
+[job "writer"]
+inherit=base
+access-pattern=100:randwrite:8k
+name=w-$jobnum
+numjobs=3
+`)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %s", err)
+	}
+	if _, ok := cfg.Job["writer"]; ok {
+		t.Errorf("writer should have been replaced by its copies")
+	}
+	for i, name := range []string{"writer.0", "writer.1", "writer.2"} {
+		jd, ok := cfg.Job[name]
+		if !ok {
+			t.Fatalf("missing job %s", name)
+		}
+		if jd.Size != "1g" || jd.Fsync != 8 {
+			t.Errorf("%s didn't inherit from base: size=%s, fsync=%d", name, jd.Size, jd.Fsync)
+		}
+		if jd.Access_Pattern != "100:randwrite:8k" {
+			t.Errorf("%s access-pattern overridden by base: %s", name, jd.Access_Pattern)
+		}
+		if jd.IODepth != 4 || jd.Runtime != "1m" {
+			t.Errorf("%s didn't pick up global values: iodepth=%d, runtime=%s", name, jd.IODepth, jd.Runtime)
+		}
+		if want := "w-" + string('0'+rune(i)); jd.Name != want {
+			t.Errorf("%s name=%s, expected %s", name, jd.Name, want)
+		}
+	}
+	if cfg.Job["base"].Fsync != 8 || cfg.Job["base"].Name != "base" {
+		t.Errorf("base job changed: %+v", cfg.Job["base"])
+	}
+}
+
+func TestInheritSetValues(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+access-pattern=100:randread:4k
+random-map
+iodepth=8
+
+[job "base"]
+name=base-target
+force-fill
+fsync=4
+
+[job "child"]
+inherit=base
+random-map=false
+force-fill=false
+fsync=0
+
+[job "grandchild"]
+inherit=child
+iodepth=2
+`)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %s", err)
+	}
+	base := cfg.Job["base"]
+	if !base.Random_Map || !base.Force_Fill || base.Fsync != 4 || base.IODepth != 8 {
+		t.Errorf("base: random-map=%v force-fill=%v fsync=%d iodepth=%d", base.Random_Map, base.Force_Fill,
+			base.Fsync, base.IODepth)
+	}
+	for _, name := range []string{"child", "grandchild"} {
+		jd := cfg.Job[name]
+		if jd.Random_Map || jd.Force_Fill || jd.Fsync != 0 {
+			t.Errorf("%s options set back to zero were replaced: random-map=%v force-fill=%v fsync=%d",
+				name, jd.Random_Map, jd.Force_Fill, jd.Fsync)
+		}
+		if jd.Name != name {
+			t.Errorf("%s inherited name %s", name, jd.Name)
+		}
+	}
+	if cfg.Job["child"].IODepth != 8 || cfg.Job["grandchild"].IODepth != 2 {
+		t.Errorf("iodepth child=%d grandchild=%d", cfg.Job["child"].IODepth, cfg.Job["grandchild"].IODepth)
+	}
+}
+
+func TestInheritLoop(t *testing.T) {
+	_, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+
+[job "a"]
+inherit=b
+
+[job "b"]
+inherit=a
+`)
+	if err == nil {
+		t.Errorf("inherit loop not detected")
+	}
+}
+
+func TestSweepExpansion(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+job-order=first, sweeper
+
+[job "first"]
+access-pattern=100:read:8k
+
+[job "sweeper"]
+iodepth=sweep(1, 8)
+access-pattern=100:rw|sweep(30,70):4k
+`)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %s", err)
+	}
+	order := *cfg.GetBarrierOrder()
+	if len(order) != 5 || len(order[0]) != 1 || order[0][0] != "first" {
+		t.Fatalf("expected first followed by 4 sweep barriers, got %v", order)
+	}
+	expected := []struct {
+		iodepth int
+		pattern string
+	}{{1, "100:rw|30:4k"}, {1, "100:rw|70:4k"}, {8, "100:rw|30:4k"}, {8, "100:rw|70:4k"}}
+	for i, e := range expected {
+		jd := cfg.Job[order[i+1][0]]
+		if jd.IODepth != e.iodepth || jd.Access_Pattern != e.pattern {
+			t.Errorf("%s: iodepth=%d, access-pattern=%s, expected %d and %s", order[i+1][0],
+				jd.IODepth, jd.Access_Pattern, e.iodepth, e.pattern)
+		}
+		if jd.Name != "sweeper" || jd.sweepLabel == "" {
+			t.Errorf("%s: name=%s, label=%s", order[i+1][0], jd.Name, jd.sweepLabel)
+		}
+	}
+
+	// The numjobs copies of each run get their own target, the same one
+	// in every run.
+	cfg, err = readTestConfig(t, `
+[global]
+version=1
+size=1g
+
+[job "a"]
+numjobs=2
+iodepth=sweep(1, 8)
+`)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %s", err)
+	}
+	for name, target := range map[string]string{"a-0.0": "a.0", "a-0.1": "a.1", "a-1.0": "a.0", "a-1.1": "a.1"} {
+		if jd, ok := cfg.Job[name]; !ok {
+			t.Errorf("no job %s", name)
+		} else if jd.Name != target {
+			t.Errorf("%s: target %s, want %s", name, jd.Name, target)
+		}
+	}
+}
+
+func TestConfigErrorPositions(t *testing.T) {
+	_, err := readTestConfig(t, `
+[global]
+version=1
+job-order=a, nosuch
+runtime=zz
+
+[job "a"]
+access-pattern=100:frob:4k
+bogus=1
+
+[job "b"]
+inherit=a
+numjobs=2
+ramp-time=5q
+`)
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("got %v, wanted ConfigErrors", err)
+	}
+	want := []struct {
+		line int
+		key  string
+	}{{4, "job-order"}, {5, "runtime"}, {8, "access-pattern"}, {9, ""}, {14, "ramp-time"}}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, wanted %d:\n%s", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		e := errs[i]
+		if e.Pos.Line != w.line || e.Pos.Column != 1 || e.Key != w.key || filepath.Base(e.Pos.Filename) != "test.j" {
+			t.Errorf("error %d is %q, wanted line %d key %q", i, e, w.line, w.key)
+		}
+	}
+}
+
+func TestFileOrder(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+access-pattern=100:randread:4k
+
+[job "zeta"]
+[job "alpha"]
+numjobs=2
+
+[barrier]
+
+[job "mid"]
+[job "swept"]
+iodepth=sweep(1,2)
+[job "last"]
+barrier
+[job "tail"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"zeta", "alpha.0", "alpha.1"}, {"mid"}, {"swept-0"}, {"swept-1"}, {"last", "tail"}}
+	if got := *cfg.GetBarrierOrder(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+access-pattern=100:randread:4k
+
+[job "a"]
+[job "b"]
+numjobs=2
+[job "c"]
+wait-for=a
+start-after=30s
+[barrier]
+[job "d"]
+wait-for=b
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"a": nil, "b.0": nil, "b.1": nil, "c": {"a"},
+		"d": {"a", "b.0", "b.1", "c"}}
+	for name, deps := range want {
+		if got := cfg.Job[name].GetWaitFor(); !reflect.DeepEqual(got, deps) {
+			t.Errorf("%s waits for %v, wanted %v", name, got, deps)
+		}
+	}
+	if d := cfg.Job["c"].GetStartAfter(); d.Seconds() != 30 {
+		t.Errorf("start-after is %s", d)
+	}
+
+	_, err = readTestConfig(t, `
+[global]
+version=1
+size=1g
+access-pattern=100:randread:4k
+
+[job "a"]
+wait-for=c
+[job "b"]
+wait-for=a
+[job "c"]
+wait-for=b
+`)
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 1 || errs[0].Msg != "jobs wait for each other: a -> c -> b -> a" || errs[0].Pos.Line != 8 {
+		t.Errorf("got %v, wanted the loop reported against a", err)
+	}
+}
+
+func TestAccessPatternRangesAndSizes(t *testing.T) {
+	jd := &JobData{Access_Pattern: "@0-10m:randread:4k,50:rw|70:4k/50,8k/30,64k/20,@20m-30m:write:4k-128k"}
+	if err := jd.parseAccessPattern(); err != nil {
+		t.Fatal(err)
+	}
+	jd.fileSize = 100 * 1024 * 1024
+	if err := jd.layoutSections(); err != nil {
+		t.Fatal(err)
+	}
+	var sections []AccessPattern
+	for e := jd.accessPattern.Front(); e != nil; e = e.Next() {
+		sections = append(sections, e.Value.(AccessPattern))
+	}
+	if len(sections) != 3 {
+		t.Fatalf("got %d sections, wanted 3", len(sections))
+	}
+	if s := sections[0]; s.sectionStart != 0 || s.weight != 10*1024*1024 || s.blkSize != 4096 {
+		t.Errorf("section 0: %+v", s)
+	}
+	if s := sections[1]; s.sectionStart != 0 || s.weight != 50*1024*1024 || s.readPercent != 70 ||
+		s.blkSize != 64*1024 || len(s.blkSizes) != 3 {
+		t.Errorf("section 1: %+v", s)
+	}
+	if s := sections[2]; s.sectionStart != 20*1024*1024 || s.weight != 10*1024*1024 || s.blkSize != 128*1024 {
+		t.Errorf("section 2: %+v", s)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if bs := sections[2].nextBlkSize(rnd); bs < 4096 || bs > 128*1024 || bs%512 != 0 {
+			t.Fatalf("block size %d out of range", bs)
+		}
+		if bs := sections[1].nextBlkSize(rnd); bs != 4096 && bs != 8192 && bs != 64*1024 {
+			t.Fatalf("block size %d not in distribution", bs)
+		}
+	}
+
+	// The original syntax still works and leaves the rest of the target idle.
+	jd = &JobData{Access_Pattern: "60:randread:8k"}
+	if err := jd.parseAccessPattern(); err != nil || jd.accessPattern.Len() != 2 {
+		t.Errorf("got %v with %d sections", err, jd.accessPattern.Len())
+	}
+
+	for _, bad := range []string{"@10m-5m:read:4k", "50:read:4k/50,8k/40", "50:read:8k-4k", "x:read:4k"} {
+		jd = &JobData{Access_Pattern: bad}
+		if err := jd.parseAccessPattern(); err == nil {
+			t.Errorf("%s should have failed", bad)
+		}
+	}
+	jd = &JobData{Access_Pattern: "@0-200m:read:4k", fileSize: 100 * 1024 * 1024}
+	if err := jd.parseAccessPattern(); err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.layoutSections(); err == nil {
+		t.Errorf("range past the end of the target should fail")
+	}
+}
+
+func TestSequentialModifiers(t *testing.T) {
+	jd := &JobData{Access_Pattern: "50:read+seqrev+stride=4k:4k,50:write+seq-per-worker:8k", IODepth: 4,
+		fileSize: 1024 * 1024}
+	if err := jd.parseAccessPattern(); err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.layoutSections(); err != nil {
+		t.Fatal(err)
+	}
+	rev := jd.accessPattern.Front().Value.(AccessPattern)
+	if rev.opDesc() != "read+seqrev+stride=4096" {
+		t.Errorf("got %s", rev.opDesc())
+	}
+	end := rev.sectionStart + rev.weight
+	want := []int64{end - 4096, end - 3*4096, end - 5*4096}
+	for i, w := range want {
+		if got := rev.nextSeq(&rev.lastBlk, rev.sectionStart, end, 4096); got != w {
+			t.Errorf("reverse I/O %d at %d, wanted %d", i, got, w)
+		}
+	}
+	rev.lastBlk = rev.sectionStart + 4096
+	if got := rev.nextSeq(&rev.lastBlk, rev.sectionStart, end, 4096); got != rev.sectionStart {
+		t.Errorf("got %d, wanted start of section", got)
+	}
+	if got := rev.nextSeq(&rev.lastBlk, rev.sectionStart, end, 4096); got != end-4096 {
+		t.Errorf("reverse didn't wrap to the end, got %d", got)
+	}
+
+	pw := jd.accessPattern.Back().Value.(AccessPattern)
+	var lastEnd int64 = pw.sectionStart
+	for w := 0; w < 4; w++ {
+		start, end := pw.workerRegion(w, 4)
+		if start != lastEnd || end-start != 128*1024 {
+			t.Errorf("worker %d region %d-%d", w, start, end)
+		}
+		lastEnd = end
+	}
+
+	for _, bad := range []string{"100:randread+seqrev:4k", "100:read+bogus:4k", "100:read+stride=x:4k"} {
+		jd = &JobData{Access_Pattern: bad}
+		if err := jd.parseAccessPattern(); err == nil {
+			t.Errorf("%s should have failed", bad)
+		}
+	}
+}
+
+func TestIOLimits(t *testing.T) {
+	jd := &JobData{Access_Pattern: "50:read:4k,25:none:4k,25:write:4k", Io_Limit: "2x", Loops: 3}
+	if err := jd.validate("limits"); err != nil {
+		t.Fatal(err)
+	}
+	jd.fileSize = 1024 * 1024
+	if err := jd.layoutSections(); err != nil {
+		t.Fatal(err)
+	}
+	if jd.ioLimit != 2*1024*1024 {
+		t.Errorf("io-limit %d, wanted twice the target size", jd.ioLimit)
+	}
+	if r := jd.limitReached(100, 2*1024*1024-1); r != StopNone {
+		t.Errorf("stopped early by %s", r)
+	}
+	if r := jd.limitReached(100, 2*1024*1024); r != StopIOLimit {
+		t.Errorf("got %s, wanted io-limit", r)
+	}
+	jd.Number_Ios = 100
+	if r := jd.limitReached(100, 0); r != StopNumberIOs {
+		t.Errorf("got %s, wanted number-ios", r)
+	}
+
+	// Every section other than none has to be passed over three times, the
+	// first section getting there isn't enough. Nothing counts while ramping.
+	jd = &JobData{Access_Pattern: "50:read:4k,25:none:4k,25:write:4k", Loops: 3}
+	if err := jd.validate("loops"); err != nil {
+		t.Fatal(err)
+	}
+	jd.fileSize = 1024 * 1024
+	if err := jd.layoutSections(); err != nil {
+		t.Fatal(err)
+	}
+	j := &Job{JobParams: jd}
+	for e := jd.accessPattern.Front(); e != nil; e = e.Next() {
+		j.sections = append(j.sections, e.Value.(AccessPattern))
+	}
+	j.resetLimits()
+	j.ramping = 1
+	for i := 0; i < 1000; i++ {
+		j.reserve(2, 4096)
+	}
+	j.ramping = 0
+	for i := 0; i < 3*512/4; i++ {
+		if r := j.reserve(0, 4096); r != StopNone {
+			t.Fatalf("stopped by %s after %d I/O's to the first section", r, i)
+		}
+	}
+	for i := 0; i < 3*256/4; i++ {
+		if r := j.reserve(2, 4096); r != StopNone {
+			t.Fatalf("stopped by %s after %d I/O's to the last section", r, i)
+		}
+	}
+	if r := j.reserve(0, 4096); r != StopLoops {
+		t.Errorf("got %s once every section was done, wanted loops", r)
+	}
+
+	for _, bad := range []string{"x", "-1x", "0", "lots"} {
+		jd = &JobData{Io_Limit: bad}
+		if err := jd.validate("bad"); err == nil {
+			t.Errorf("io-limit=%s should have failed", bad)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package support
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CPUResult is how much CPU the process used while a job ran. The rusage
+// numbers are for the whole process so jobs which run at the same time share
+// them.
+type CPUResult struct {
+	User             time.Duration
+	System           time.Duration
+	CPUPercent       float64
+	IOsPerCPUSecond  float64
+	VoluntaryCtxSw   int64
+	InvoluntaryCtxSw int64
+	MajorFaults      int64
+	MinorFaults      int64
+
+	// Utilisation of each CPU in the system from /proc/stat, only where
+	// it's available.
+	PerCPU []float64 `json:",omitempty"`
+}
+
+// cpuTicks are the busy and total jiffies of one CPU from /proc/stat.
+type cpuTicks struct {
+	busy  uint64
+	total uint64
+}
+
+// cpuSample is the resource usage of the process and the time spent by every
+// CPU at one moment. A job takes one when it starts and one when it's done.
+type cpuSample struct {
+	when   time.Time
+	rusage syscall.Rusage
+	cpus   []cpuTicks
+}
+
+func takeCPUSample() cpuSample {
+	s := cpuSample{when: time.Now(), cpus: readCPUTicks()}
+	_ = syscall.Getrusage(syscall.RUSAGE_SELF, &s.rusage)
+	return s
+}
+
+// cpuSince works out what was used between start and end while ios I/O's
+// were done.
+func cpuSince(start, end cpuSample, ios int64) *CPUResult {
+	r := &CPUResult{
+		User:             time.Duration(end.rusage.Utime.Nano() - start.rusage.Utime.Nano()),
+		System:           time.Duration(end.rusage.Stime.Nano() - start.rusage.Stime.Nano()),
+		VoluntaryCtxSw:   int64(end.rusage.Nvcsw - start.rusage.Nvcsw),
+		InvoluntaryCtxSw: int64(end.rusage.Nivcsw - start.rusage.Nivcsw),
+		MajorFaults:      int64(end.rusage.Majflt - start.rusage.Majflt),
+		MinorFaults:      int64(end.rusage.Minflt - start.rusage.Minflt),
+	}
+	used := (r.User + r.System).Seconds()
+	if elapsed := end.when.Sub(start.when).Seconds(); elapsed > 0 {
+		r.CPUPercent = used / elapsed * 100
+	}
+	if used > 0 {
+		r.IOsPerCPUSecond = float64(ios) / used
+	}
+	if len(start.cpus) == len(end.cpus) {
+		for i := range end.cpus {
+			pct := 0.0
+			if total := end.cpus[i].total - start.cpus[i].total; total > 0 {
+				pct = float64(end.cpus[i].busy-start.cpus[i].busy) / float64(total) * 100
+			}
+			r.PerCPU = append(r.PerCPU, pct)
+		}
+	}
+	return r
+}
+
+// String is the line shown for a job in the summary.
+func (r *CPUResult) String() string {
+	s := fmt.Sprintf("%.1f%% (user %s, sys %s), %s I/Os per CPU-second, "+
+		"ctx switches vol %d invol %d, faults major %d minor %d",
+		r.CPUPercent, r.User.Round(time.Millisecond), r.System.Round(time.Millisecond),
+		strings.TrimSpace(Humanize(int64(r.IOsPerCPUSecond), 1)), r.VoluntaryCtxSw, r.InvoluntaryCtxSw,
+		r.MajorFaults, r.MinorFaults)
+	if len(r.PerCPU) != 0 {
+		avg, busiest := 0.0, 0.0
+		for _, pct := range r.PerCPU {
+			avg += pct
+			if pct > busiest {
+				busiest = pct
+			}
+		}
+		s += fmt.Sprintf(", system CPUs %.1f%% avg %.1f%% busiest", avg/float64(len(r.PerCPU)), busiest)
+	}
+	return s
+}
+
+// parseProcStat returns the ticks of each cpuN line, the cpu line with the
+// totals is skipped. Time spent idle or waiting for I/O isn't busy.
+func parseProcStat(r io.Reader) ([]cpuTicks, error) {
+	var cpus []cpuTicks
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		var t cpuTicks
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", fields[0], err)
+			}
+			// Guest time is already included in user and nice.
+			if i >= 8 {
+				break
+			}
+			t.total += v
+			if i != 3 && i != 4 {
+				t.busy += v
+			}
+		}
+		cpus = append(cpus, t)
+	}
+	return cpus, scanner.Err()
+}
@@ -0,0 +1,18 @@
+package support
+
+import "os"
+
+// readCPUTicks returns the time spent by each CPU so far, nil if /proc/stat
+// can't be read.
+func readCPUTicks() []cpuTicks {
+	fp, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil
+	}
+	defer fp.Close()
+	cpus, err := parseProcStat(fp)
+	if err != nil {
+		return nil
+	}
+	return cpus
+}
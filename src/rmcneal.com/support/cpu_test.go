@@ -0,0 +1,47 @@
+package support
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const procStat = `cpu  300 0 100 600 0 0 0 0 0 0
+cpu0 200 0 50 250 0 0 0 0 0 0
+cpu1 100 0 50 300 50 0 0 0 10 0
+intr 12345 0 0
+ctxt 6789
+`
+
+func TestCPUResult(t *testing.T) {
+	cpus, err := parseProcStat(strings.NewReader(procStat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cpus) != 2 || cpus[0] != (cpuTicks{busy: 250, total: 500}) || cpus[1] != (cpuTicks{busy: 150, total: 500}) {
+		t.Fatalf("parsed %+v", cpus)
+	}
+	if _, err := parseProcStat(strings.NewReader("cpu0 1 2 x 4 5\n")); err == nil {
+		t.Error("bad tick count wasn't caught")
+	}
+
+	now := time.Now()
+	start := cpuSample{when: now, cpus: cpus}
+	end := cpuSample{when: now.Add(2 * time.Second),
+		cpus: []cpuTicks{{busy: 350, total: 700}, {busy: 150, total: 700}}}
+	end.rusage.Utime = syscall.NsecToTimeval(int64(600 * time.Millisecond))
+	end.rusage.Stime = syscall.NsecToTimeval(int64(400 * time.Millisecond))
+	end.rusage.Nivcsw = 3
+	r := cpuSince(start, end, 50000)
+	if r.CPUPercent != 50 || r.IOsPerCPUSecond != 50000 || r.InvoluntaryCtxSw != 3 {
+		t.Errorf("rusage: %+v", r)
+	}
+	if len(r.PerCPU) != 2 || r.PerCPU[0] != 50 || r.PerCPU[1] != 0 {
+		t.Errorf("per-CPU: %v", r.PerCPU)
+	}
+	if s := r.String(); !strings.Contains(s, "50.0% (user 600ms, sys 400ms)") ||
+		!strings.Contains(s, "25.0% avg 50.0% busiest") {
+		t.Errorf("summary line: %s", s)
+	}
+}
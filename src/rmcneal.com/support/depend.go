@@ -0,0 +1,126 @@
+package support
+
+import (
+	"strings"
+)
+
+// runNames are the jobs which are run for a name used in the job file. Jobs
+// using sweep(...) or numjobs are replaced by all of their copies.
+func (c *Configs) runNames(name string) []string {
+	if sweeps, ok := c.sweeps[name]; ok {
+		var names []string
+		for _, sweepName := range sweeps {
+			names = append(names, c.runNames(sweepName)...)
+		}
+		return names
+	}
+	if copies, ok := c.clones[name]; ok {
+		return copies
+	}
+	if _, ok := c.Job[name]; ok {
+		return []string{name}
+	}
+	return nil
+}
+
+//
+// buildDependencies -- work out which jobs each job waits for
+//
+// job-order and barriers are turned into the same thing as wait-for. Every
+// job after a barrier waits for all of the jobs in the group before it, and
+// each sweep copy waits for the one before. A job with wait-for=A,B also
+// waits for every copy of A and B. Jobs which end up waiting on each other
+// would never start so any loop is an error.
+//
+func (c *Configs) buildDependencies() error {
+	var errs ConfigErrors
+	running := map[string]bool{}
+	for _, name := range c.Global.jobOrder {
+		running[name] = true
+	}
+	add := func(jd *JobData, dep string) {
+		for _, d := range jd.waitFor {
+			if d == dep {
+				return
+			}
+		}
+		jd.waitFor = append(jd.waitFor, dep)
+	}
+
+	order := c.Global.barrierOrder
+	for idx := 1; idx < len(order); idx++ {
+		for _, name := range order[idx] {
+			for _, dep := range order[idx-1] {
+				add(c.Job[name], dep)
+			}
+		}
+	}
+
+	for _, name := range c.Global.jobOrder {
+		jd := c.Job[name]
+		for _, want := range strings.FieldsFunc(jd.Wait_For, FindComma) {
+			want = strings.TrimSpace(want)
+			deps := c.runNames(want)
+			if deps == nil {
+				errs.add(name, "wait-for", "unknown job [%s]", want)
+				continue
+			}
+			for _, dep := range deps {
+				if dep == name {
+					errs.add(name, "wait-for", "job waits for itself")
+				} else if !running[dep] {
+					errs.add(name, "wait-for", "[%s] isn't in job-order so would never finish", dep)
+				} else {
+					add(jd, dep)
+				}
+			}
+		}
+	}
+	if len(errs) == 0 {
+		errs.append(c.findLoop())
+	}
+	return errs.err()
+}
+
+// findLoop returns an error naming the jobs around the first wait-for loop
+// found, if there is one.
+func (c *Configs) findLoop() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var stack, loop []string
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range c.Job[name].waitFor {
+			switch state[dep] {
+			case visiting:
+				for i, n := range stack {
+					if n == dep {
+						loop = append(append(loop, stack[i:]...), dep)
+						break
+					}
+				}
+				return true
+			case unvisited:
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return false
+	}
+	for _, name := range c.Global.jobOrder {
+		if state[name] == unvisited && visit(name) {
+			return optionError(loop[0], "wait-for", "jobs wait for each other: %s",
+				strings.Join(loop, " -> "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package support
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/gcfg.v1/scanner"
+	"gopkg.in/gcfg.v1/token"
+)
+
+// ConfigError is a single problem found in a job file. Section and Key name
+// the option at fault when known so that Pos can be filled in from the layout
+// of the file once all of the checks have been done.
+type ConfigError struct {
+	Pos     token.Position
+	Section string
+	Key     string
+	Msg     string
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	if e.Pos.IsValid() {
+		b.WriteString(e.Pos.String() + ": ")
+	}
+	if e.Section != "" {
+		_, _ = fmt.Fprintf(&b, "[%s] ", e.Section)
+	}
+	if e.Key != "" {
+		b.WriteString(e.Key + ": ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+func optionError(section, key, format string, a ...interface{}) *ConfigError {
+	return &ConfigError{Section: section, Key: key, Msg: fmt.Sprintf(format, a...)}
+}
+
+// ConfigErrors is every problem found while reading a job file.
+type ConfigErrors []*ConfigError
+
+func (l ConfigErrors) Error() string {
+	lines := make([]string, len(l))
+	for i, e := range l {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *ConfigErrors) add(section, key, format string, a ...interface{}) {
+	*l = append(*l, optionError(section, key, format, a...))
+}
+
+// append adds err, which may already be a ConfigError or list of them.
+func (l *ConfigErrors) append(err error) {
+	switch e := err.(type) {
+	case nil:
+	case ConfigErrors:
+		*l = append(*l, e...)
+	case *ConfigError:
+		*l = append(*l, e)
+	case scanner.ErrorList:
+		for _, se := range e {
+			*l = append(*l, &ConfigError{Pos: se.Pos, Msg: se.Msg})
+		}
+	default:
+		*l = append(*l, &ConfigError{Msg: err.Error()})
+	}
+}
+
+func (l ConfigErrors) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// sort orders the errors by where they're found in the file. Errors without a
+// position go last.
+func (l ConfigErrors) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Pos, l[j].Pos
+		if a.IsValid() != b.IsValid() {
+			return a.IsValid()
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+//
+// position -- find where an option for a section came from in the job file
+//
+// Jobs created by numjobs or sweep(...) use the section of the job they were
+// copied from. An option the job doesn't set itself is looked for in the job
+// named by inherit and then [global]. If the option can't be found at all the
+// position of the section header is used.
+//
+func (c *Configs) position(section, key string) token.Position {
+	if section == "global" {
+		if v := c.layout.Var("global", "", key); v != nil {
+			return v.Pos
+		} else if global := c.layout.Section("global", ""); global != nil {
+			return global.Pos
+		}
+		return token.Position{}
+	}
+
+	if jd, ok := c.Job[section]; ok && jd.section != "" {
+		section = jd.section
+	}
+	start := c.layout.Section("job", section)
+	if start == nil {
+		return token.Position{}
+	}
+	if key == "" {
+		return start.Pos
+	}
+	name := section
+	for n := 0; n <= len(c.layout.Sections); n++ {
+		if v := c.layout.Var("job", name, key); v != nil {
+			return v.Pos
+		}
+		inherit := c.layout.Var("job", name, "inherit")
+		if inherit == nil {
+			break
+		}
+		name = inherit.Value
+	}
+	if v := c.layout.Var("global", "", key); v != nil {
+		return v.Pos
+	}
+	return start.Pos
+}
+
+// unique drops errors for the same problem at the same place. An option set in
+// [global] or an inherited job is checked again for every job which uses it.
+func (l ConfigErrors) unique() ConfigErrors {
+	var out ConfigErrors
+	for _, e := range l {
+		dup := false
+		for _, prev := range out {
+			if e.Pos.IsValid() && prev.Pos == e.Pos && prev.Key == e.Key && prev.Msg == e.Msg {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// locate fills in the position of each error which doesn't have one yet.
+func (c *Configs) locate(errs ConfigErrors) {
+	for _, e := range errs {
+		if !e.Pos.IsValid() && e.Section != "" {
+			e.Pos = c.position(e.Section, e.Key)
+		}
+	}
+}
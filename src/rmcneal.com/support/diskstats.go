@@ -0,0 +1,211 @@
+package support
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diskStatsPath is where the block layer's counters are read from.
+const diskStatsPath = "/proc/diskstats"
+
+// DeviceSample is the device activity during one record-time interval.
+type DeviceSample struct {
+	IOPS         int64
+	Utilisation  float64
+	AvgQueueSize float64
+}
+
+// DeviceResult is what the block layer saw of the device holding a job's
+// target. Anything else using the device is included as well.
+type DeviceResult struct {
+	Device       string
+	ReadIOPS     int64
+	WriteIOPS    int64
+	ReadMerges   int64
+	WriteMerges  int64
+	ReadBW       int64
+	WriteBW      int64
+	AvgQueueSize float64
+	Utilisation  float64
+	ReadAwait    time.Duration
+	WriteAwait   time.Duration
+	Samples      []DeviceSample `json:",omitempty"`
+}
+
+// diskCounters are the first eleven fields after the device name in a line
+// of /proc/diskstats. Times are in milliseconds, sectors are 512 bytes.
+type diskCounters struct {
+	reads         uint64
+	readMerges    uint64
+	readSectors   uint64
+	readTicks     uint64
+	writes        uint64
+	writeMerges   uint64
+	writeSectors  uint64
+	writeTicks    uint64
+	inFlight      uint64
+	ioTicks       uint64
+	weightedTicks uint64
+}
+
+//
+// diskSampler -- follows the diskstats counters of one device
+//
+// The stats thread reads the counters when a job's numbers are cleared, at
+// each record-time tick, and when the job is done. Only the stats thread uses
+// it. path is normally diskStatsPath, tests use a fixture instead.
+//
+type diskSampler struct {
+	path   string
+	device string
+
+	start     diskCounters
+	startTime time.Time
+	prev      diskCounters
+	prevTime  time.Time
+	end       diskCounters
+	endTime   time.Time
+	samples   []DeviceSample
+	failed    bool
+}
+
+// newDiskSampler returns nil when the device holding target can't be found
+// or isn't listed in /proc/diskstats, the job is then run without device stats.
+func newDiskSampler(target string) *diskSampler {
+	device, err := targetDevice(target)
+	if err != nil {
+		return nil
+	}
+	d := &diskSampler{path: diskStatsPath, device: device}
+	if _, err := d.read(); err != nil {
+		return nil
+	}
+	return d
+}
+
+func (d *diskSampler) read() (diskCounters, error) {
+	var c diskCounters
+	fp, err := os.Open(d.path)
+	if err != nil {
+		return c, err
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 || fields[2] != d.device {
+			continue
+		}
+		for i, dst := range []*uint64{&c.reads, &c.readMerges, &c.readSectors, &c.readTicks, &c.writes,
+			&c.writeMerges, &c.writeSectors, &c.writeTicks, &c.inFlight, &c.ioTicks, &c.weightedTicks} {
+			if *dst, err = strconv.ParseUint(fields[3+i], 10, 64); err != nil {
+				return c, fmt.Errorf("%s: %s", d.device, err)
+			}
+		}
+		return c, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return c, err
+	}
+	return c, fmt.Errorf("%s not in %s", d.device, d.path)
+}
+
+// reset starts measuring from now. Should the device stop being readable the
+// job simply doesn't report device stats.
+func (d *diskSampler) reset(now time.Time) {
+	c, err := d.read()
+	d.failed = err != nil
+	d.start, d.startTime = c, now
+	d.prev, d.prevTime = c, now
+	d.endTime = time.Time{}
+	d.samples = nil
+}
+
+// tick records the activity since the previous tick.
+func (d *diskSampler) tick(now time.Time) {
+	if d.failed || !d.endTime.IsZero() {
+		return
+	}
+	c, err := d.read()
+	if err != nil {
+		d.failed = true
+		return
+	}
+	r := deviceRates(&d.prev, &c, now.Sub(d.prevTime))
+	d.samples = append(d.samples, DeviceSample{IOPS: r.ReadIOPS + r.WriteIOPS, Utilisation: r.Utilisation,
+		AvgQueueSize: r.AvgQueueSize})
+	d.prev, d.prevTime = c, now
+}
+
+// finish takes the final reading once the job is done.
+func (d *diskSampler) finish(now time.Time) {
+	if d.failed {
+		return
+	}
+	c, err := d.read()
+	if err != nil {
+		d.failed = true
+		return
+	}
+	d.end, d.endTime = c, now
+}
+
+// result covers the whole run, or up to now if the job isn't done.
+func (d *diskSampler) result() *DeviceResult {
+	if d.failed {
+		return nil
+	}
+	end, endTime := d.end, d.endTime
+	if endTime.IsZero() {
+		var err error
+		if end, err = d.read(); err != nil {
+			return nil
+		}
+		endTime = time.Now()
+	}
+	r := deviceRates(&d.start, &end, endTime.Sub(d.startTime))
+	r.Device = d.device
+	r.Samples = append([]DeviceSample(nil), d.samples...)
+	return r
+}
+
+// deviceRates works out the same numbers as iostat -x from two readings.
+func deviceRates(a, b *diskCounters, elapsed time.Duration) *DeviceResult {
+	r := &DeviceResult{ReadMerges: int64(b.readMerges - a.readMerges),
+		WriteMerges: int64(b.writeMerges - a.writeMerges)}
+	reads, writes := b.reads-a.reads, b.writes-a.writes
+	if reads != 0 {
+		r.ReadAwait = time.Duration(b.readTicks-a.readTicks) * time.Millisecond / time.Duration(reads)
+	}
+	if writes != 0 {
+		r.WriteAwait = time.Duration(b.writeTicks-a.writeTicks) * time.Millisecond / time.Duration(writes)
+	}
+	secs := elapsed.Seconds()
+	if secs <= 0 {
+		return r
+	}
+	r.ReadIOPS = int64(float64(reads) / secs)
+	r.WriteIOPS = int64(float64(writes) / secs)
+	r.ReadBW = int64(float64(b.readSectors-a.readSectors) * 512 / secs)
+	r.WriteBW = int64(float64(b.writeSectors-a.writeSectors) * 512 / secs)
+	ms := secs * 1000
+	r.Utilisation = float64(b.ioTicks-a.ioTicks) / ms * 100
+	if r.Utilisation > 100 {
+		r.Utilisation = 100
+	}
+	r.AvgQueueSize = float64(b.weightedTicks-a.weightedTicks) / ms
+	return r
+}
+
+// String is the line shown for a job in the summary.
+func (r *DeviceResult) String() string {
+	return fmt.Sprintf("%s: IOPS %s (r:%s,w:%s), BW %s, merges r:%d w:%d, avg queue %.2f, util %.1f%%, "+
+		"await r:%s w:%s", r.Device, strings.TrimSpace(Humanize(r.ReadIOPS+r.WriteIOPS, 1)),
+		strings.TrimSpace(Humanize(r.ReadIOPS, 1)), strings.TrimSpace(Humanize(r.WriteIOPS, 1)),
+		strings.TrimSpace(Humanize(r.ReadBW+r.WriteBW, 1)), r.ReadMerges, r.WriteMerges, r.AvgQueueSize,
+		r.Utilisation, r.ReadAwait, r.WriteAwait)
+}
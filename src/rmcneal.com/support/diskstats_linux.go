@@ -0,0 +1,41 @@
+package support
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// sysDevBlock has a link for each block device named by its major:minor.
+const sysDevBlock = "/sys/dev/block"
+
+// targetDevice returns the name /proc/diskstats uses for the block device
+// which is the target or which holds the file system the target is in.
+func targetDevice(target string) (string, error) {
+	fi, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("no device for %s", target)
+	}
+	dev := st.Dev
+	if fi.Mode()&os.ModeDevice != 0 && fi.Mode()&os.ModeCharDevice == 0 {
+		dev = st.Rdev
+	}
+	link, err := os.Readlink(filepath.Join(sysDevBlock, devNumber(uint64(dev))))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(link), nil
+}
+
+// devNumber is the major:minor of dev as used by /sys/dev/block and
+// /proc/self/mountinfo.
+func devNumber(dev uint64) string {
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	return fmt.Sprintf("%d:%d", major, minor)
+}
@@ -0,0 +1,8 @@
+package support
+
+import "fmt"
+
+// targetDevice always fails, there's no /proc/diskstats to sample here.
+func targetDevice(target string) (string, error) {
+	return "", fmt.Errorf("device stats aren't available")
+}
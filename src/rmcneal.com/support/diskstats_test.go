@@ -0,0 +1,51 @@
+package support
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiskSampler(t *testing.T) {
+	d := &diskSampler{path: "testdata/diskstats.0", device: "sda"}
+	start := time.Now()
+	d.reset(start)
+	if d.failed || d.start.reads != 1000 || d.start.weightedTicks != 4500 {
+		t.Fatalf("first reading: %+v", d.start)
+	}
+
+	// Over two seconds sda did 2000 reads and 4000 writes.
+	d.path = "testdata/diskstats.1"
+	d.tick(start.Add(2 * time.Second))
+	d.finish(start.Add(2 * time.Second))
+	r := d.result()
+	if r == nil {
+		t.Fatal("no result")
+	}
+	if r.Device != "sda" || r.ReadIOPS != 1000 || r.WriteIOPS != 2000 || r.ReadMerges != 20 || r.WriteMerges != 100 {
+		t.Errorf("rates: %+v", r)
+	}
+	if r.ReadBW != 40960000 || r.WriteBW != 81920000 {
+		t.Errorf("bandwidth r:%d w:%d", r.ReadBW, r.WriteBW)
+	}
+	if r.ReadAwait != time.Millisecond || r.WriteAwait != 3*time.Millisecond {
+		t.Errorf("await r:%s w:%s", r.ReadAwait, r.WriteAwait)
+	}
+	if r.Utilisation != 50 || r.AvgQueueSize != 4 {
+		t.Errorf("util %.1f%%, queue %.2f", r.Utilisation, r.AvgQueueSize)
+	}
+	if len(r.Samples) != 1 || r.Samples[0].IOPS != 3000 {
+		t.Errorf("samples: %+v", r.Samples)
+	}
+
+	// Ticks after the job is done don't add samples.
+	d.tick(start.Add(3 * time.Second))
+	if len(d.result().Samples) != 1 {
+		t.Error("sample taken after finish")
+	}
+
+	missing := &diskSampler{path: "testdata/diskstats.0", device: "sdz"}
+	missing.reset(start)
+	if missing.result() != nil {
+		t.Error("result for a device that isn't listed")
+	}
+}
@@ -0,0 +1,130 @@
+package support
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// guardScan is how much of the start of a device is read looking for
+// signatures. Enough to cover the ZFS uberblocks in the first label.
+const guardScan = 256 * 1024
+
+// signature is a magic value which a partition table, file system, volume
+// manager or RAID leaves at a fixed offset on the device.
+type signature struct {
+	what   string
+	offset int
+	magic  string
+}
+
+var signatures = []signature{
+	{"a GPT partition table", 512, "EFI PART"},
+	{"a GPT partition table", 4096, "EFI PART"},
+	{"an ext2/3/4 file system", 1080, "\x53\xef"},
+	{"an XFS file system", 0, "XFSB"},
+	{"a btrfs file system", 65600, "_BHRfS_M"},
+	{"an NTFS file system", 3, "NTFS    "},
+	{"a FAT file system", 82, "FAT32   "},
+	{"a FAT file system", 54, "FAT1"},
+	{"an LVM physical volume", 536, "LVM2 001"},
+	{"a LUKS encrypted volume", 0, "LUKS\xba\xbe"},
+	{"a RAID member", 0, "\xfc\x4e\x2b\xa9"},
+	{"a RAID member", 4096, "\xfc\x4e\x2b\xa9"},
+	{"swap space", 4086, "SWAPSPACE2"},
+	{"an MBR partition table or boot sector", 510, "\x55\xaa"},
+}
+
+// ZFS has an array of 1k uberblocks starting 128k into each label, any one
+// of them having the magic number in either byte order is enough.
+const (
+	zfsUberblocks    = 128 * 1024
+	zfsUberblockSize = 1024
+	zfsMagicLE       = "\x0c\xb1\xba\x00"
+	zfsMagicBE       = "\x00\xba\xb1\x0c"
+)
+
+// findSignatures lists what buf, the start of a device, appears to hold.
+func findSignatures(buf []byte) []string {
+	var found []string
+	add := func(what string) {
+		for _, f := range found {
+			if f == what {
+				return
+			}
+		}
+		found = append(found, what)
+	}
+	for _, s := range signatures {
+		if end := s.offset + len(s.magic); end <= len(buf) && string(buf[s.offset:end]) == s.magic {
+			add(s.what)
+		}
+	}
+	for off := zfsUberblocks; off+zfsUberblockSize <= len(buf) && off < 2*zfsUberblocks; off += zfsUberblockSize {
+		if string(buf[off:off+4]) == zfsMagicLE || string(buf[off+4:off+8]) == zfsMagicBE {
+			add("a ZFS pool member")
+			break
+		}
+	}
+	return found
+}
+
+// writesTarget is true if the job could change what's on its target, through
+// either the access pattern or force-fill.
+func (j *JobData) writesTarget() bool {
+	if j.Force_Fill {
+		return true
+	}
+	if j.accessPattern == nil {
+		return false
+	}
+	for e := j.accessPattern.Front(); e != nil; e = e.Next() {
+		switch e.Value.(AccessPattern).opType {
+		case WriteSeqType, WriteRandType, RwrandType, RwseqType, RwrandVerifyType:
+			return true
+		}
+	}
+	return false
+}
+
+//
+// guardTarget -- refuse to write to a device which is in use or holds data
+//
+// A device the job will write to is checked for being mounted, used for swap or
+// held by another driver, and for a partition table or any of the signatures above.
+// Last of all, where the system has a way to tell, that nothing else has the device
+// open exclusively. If anything is found the job is refused unless it sets
+// allow-destructive. Regular files are never checked.
+//
+// The device isn't kept open exclusively for the run. numjobs copies and jobs
+// which overlap are free to use the same device.
+//
+func guardTarget(path string, fi os.FileInfo, jd *JobData) error {
+	if fi.Mode()&os.ModeDevice == 0 || jd.Allow_Destructive || !jd.writesTarget() {
+		return nil
+	}
+	found, err := deviceInUse(fi)
+	if err != nil {
+		return err
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	buf := make([]byte, guardScan)
+	n, err := fp.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	found = append(found, findSignatures(buf[:n])...)
+	if len(found) == 0 && exclusiveBusy(path) {
+		found = append(found, "in use by another program")
+	}
+	if len(found) != 0 {
+		return fmt.Errorf("refusing to write to %s: %s, set allow-destructive=yes to use it anyway",
+			path, strings.Join(found, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package support
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Octal escapes used for white space and backslashes in mountinfo paths.
+var mountUnescape = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+// exclusiveBusy is true if opening the block device with O_EXCL fails with
+// EBUSY, meaning something such as a mount or device mapper has claimed it. The
+// device is closed again straight away.
+func exclusiveBusy(path string) bool {
+	fp, err := os.OpenFile(path, os.O_RDONLY|syscall.O_EXCL, 0)
+	if err != nil {
+		pe, ok := err.(*os.PathError)
+		return ok && pe.Err == syscall.EBUSY
+	}
+	_ = fp.Close()
+	return false
+}
+
+// usageFiles are where deviceInUse looks. Normally systemUsage, tests use
+// fixtures instead.
+type usageFiles struct {
+	mountinfo string
+	swaps     string
+	devBlock  string
+}
+
+var systemUsage = usageFiles{mountinfo: "/proc/self/mountinfo", swaps: "/proc/swaps", devBlock: sysDevBlock}
+
+// partitions returns the names of a block device and its partitions by their
+// major:minor. The device's directory in /sys is returned as well.
+func (u usageFiles) partitions(num string) (string, map[string]string) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(u.devBlock, num))
+	if err != nil {
+		return "", nil
+	}
+	devs := map[string]string{num: filepath.Base(dir)}
+	entries, _ := ioutil.ReadDir(dir)
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(dir, e.Name(), "partition")); err != nil {
+			continue
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(dir, e.Name(), "dev")); err == nil {
+			devs[strings.TrimSpace(string(b))] = e.Name()
+		}
+	}
+	return dir, devs
+}
+
+// deviceName returns the block device name a /dev path resolves to.
+func deviceName(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Base(path)
+}
+
+//
+// deviceInUse -- list the ways a block device or its partitions are being used
+//
+// Mounts are found in /proc/self/mountinfo, by major:minor or by the source
+// device for file systems such as btrfs which report their own. Swap comes from
+// /proc/swaps and device mapper, RAID and the like show up as holders in /sys.
+// Character devices and anything /sys doesn't know about aren't checked.
+//
+func deviceInUse(fi os.FileInfo) ([]string, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if fi.Mode()&os.ModeCharDevice != 0 || !ok {
+		return nil, nil
+	}
+	return systemUsage.inUse(devNumber(uint64(st.Rdev))), nil
+}
+
+// inUse lists the ways the block device num, a major:minor, or its partitions
+// are being used.
+func (u usageFiles) inUse(num string) []string {
+	dir, devs := u.partitions(num)
+	if devs == nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, name := range devs {
+		names[name] = true
+	}
+
+	var found []string
+	add := func(format string, args ...interface{}) {
+		s := fmt.Sprintf(format, args...)
+		for _, f := range found {
+			if f == s {
+				return
+			}
+		}
+		found = append(found, s)
+	}
+
+	if fp, err := os.Open(u.mountinfo); err == nil {
+		scanner := bufio.NewScanner(fp)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			sep := -1
+			for i, f := range fields {
+				if f == "-" {
+					sep = i
+					break
+				}
+			}
+			if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+				continue
+			}
+			name, ok := devs[fields[2]]
+			if !ok && strings.HasPrefix(fields[sep+2], "/dev/") {
+				if source := deviceName(mountUnescape.Replace(fields[sep+2])); names[source] {
+					name, ok = source, true
+				}
+			}
+			if ok {
+				add("%s mounted on %s", name, mountUnescape.Replace(fields[4]))
+			}
+		}
+		_ = fp.Close()
+	}
+
+	if b, err := ioutil.ReadFile(u.swaps); err == nil {
+		for _, line := range strings.Split(string(b), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && names[deviceName(fields[0])] {
+				add("%s used for swap", deviceName(fields[0]))
+			}
+		}
+	}
+
+	// The kernel may still have partitions whose table has been overwritten.
+	var parts []string
+	for _, name := range devs {
+		if name != filepath.Base(dir) {
+			parts = append(parts, name)
+		}
+	}
+	if len(parts) != 0 {
+		sort.Strings(parts)
+		add("partitions %s", strings.Join(parts, ", "))
+	}
+
+	for _, name := range devs {
+		holders := filepath.Join(dir, "holders")
+		if name != filepath.Base(dir) {
+			holders = filepath.Join(dir, name, "holders")
+		}
+		entries, _ := ioutil.ReadDir(holders)
+		for _, e := range entries {
+			add("%s held by %s", name, e.Name())
+		}
+	}
+	return found
+}
@@ -0,0 +1,112 @@
+package support
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestDeviceInUse(t *testing.T) {
+	u := usageFiles{mountinfo: "testdata/guard/mountinfo", swaps: "testdata/guard/swaps",
+		devBlock: "testdata/guard/dev/block"}
+
+	// sda1 is mounted on a path with a space, sda2 is btrfs which has its own
+	// major:minor, sda4 is swap and sda3 belongs to device mapper. Nothing on
+	// sdb counts.
+	want := []string{
+		"sda1 mounted on /mnt/my disk",
+		"sda2 mounted on /data",
+		"sda4 used for swap",
+		"partitions sda1, sda2, sda3, sda4",
+		"sda3 held by dm-0",
+	}
+	if got := u.inUse("8:0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("sda found %q, want %q", got, want)
+	}
+	if got := u.inUse("8:32"); got != nil {
+		t.Errorf("unused sdc found %q", got)
+	}
+	if got := u.inUse("8:48"); got != nil {
+		t.Errorf("device missing from /sys found %q", got)
+	}
+}
+
+// loopDevice attaches a loop device to a blank file, the test is skipped if
+// that can't be done.
+func loopDevice(t *testing.T, size int64) string {
+	if os.Getuid() != 0 {
+		t.Skip("needs root for a loop device")
+	}
+	if _, err := exec.LookPath("losetup"); err != nil {
+		t.Skip("no losetup")
+	}
+	fp, err := ioutil.TempFile("", "fiod-loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(fp.Name()) })
+	err = fp.Truncate(size)
+	fp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("losetup", "--find", "--show", fp.Name()).Output()
+	if err != nil {
+		t.Skipf("losetup: %s", err)
+	}
+	dev := strings.TrimSpace(string(out))
+	t.Cleanup(func() { exec.Command("losetup", "-d", dev).Run() })
+	return dev
+}
+
+func TestGuardNumjobs(t *testing.T) {
+	dev := loopDevice(t, 8*1024*1024)
+	cfg, err := readTestConfig(t, fmt.Sprintf(`
+[global]
+version=1
+record-time=1h
+
+[job "dev"]
+name=%s
+size=1m
+numjobs=2
+access-pattern=100:randwrite:4k
+`, dev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := StatsInit(&cfg.Global, PrintInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Send(StatsRecord{OpType: StatStop})
+
+	// Both copies open the device, the first holding it open doesn't make
+	// it look in use to the second.
+	for _, name := range []string{"dev.0", "dev.1"} {
+		j, err := JobInit(name, cfg.Job[name], stats)
+		if err != nil {
+			t.Fatalf("[%s] %s", name, err)
+		}
+		defer j.Fini()
+	}
+
+	// Something else holding it exclusively does.
+	fp, err := os.OpenFile(dev, os.O_RDONLY|syscall.O_EXCL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	fi, err := os.Stat(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guardTarget(dev, fi, cfg.Job["dev.0"]); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("device held exclusively gave %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package support
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindSignatures(t *testing.T) {
+	at := func(offset int, magic string) []byte {
+		buf := make([]byte, guardScan)
+		copy(buf[offset:], magic)
+		return buf
+	}
+	gpt := at(510, "\x55\xaa")
+	copy(gpt[512:], "EFI PART")
+
+	tests := []struct {
+		name string
+		buf  []byte
+		want []string
+	}{
+		{"blank", make([]byte, guardScan), nil},
+		{"short", []byte("XFS"), nil},
+		{"gpt", gpt, []string{"a GPT partition table", "an MBR partition table or boot sector"}},
+		{"ext4", at(1080, "\x53\xef"), []string{"an ext2/3/4 file system"}},
+		{"xfs", at(0, "XFSB"), []string{"an XFS file system"}},
+		{"lvm", at(536, "LVM2 001"), []string{"an LVM physical volume"}},
+		{"raid", at(4096, "\xfc\x4e\x2b\xa9"), []string{"a RAID member"}},
+		{"swap", at(4086, "SWAPSPACE2"), []string{"swap space"}},
+		{"zfs", at(zfsUberblocks+5*zfsUberblockSize, zfsMagicLE), []string{"a ZFS pool member"}},
+		{"zfs be", at(zfsUberblocks+zfsUberblockSize+4, zfsMagicBE), []string{"a ZFS pool member"}},
+		{"zfs data", at(zfsUberblocks+100, zfsMagicLE), nil},
+	}
+	for _, tc := range tests {
+		if got := findSignatures(tc.buf); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: found %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWritesTarget(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+size=1g
+
+[job "read"]
+access-pattern=50:randread:4k,50:read:64k
+
+[job "fill"]
+access-pattern=100:randread:4k
+force-fill
+
+[job "mixed"]
+access-pattern=90:read:4k,10:rw|70:4k
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"read": false, "fill": true, "mixed": true} {
+		if got := cfg.Job[name].writesTarget(); got != want {
+			t.Errorf("[%s] writesTarget %v, want %v", name, got, want)
+		}
+	}
+}
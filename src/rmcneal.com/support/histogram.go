@@ -57,26 +57,80 @@ func (d *DistroGraph) Add(src *DistroGraph) {
 }
 
 func (d *DistroGraph) Aggregate(t time.Duration) {
+	d.Bins[d.bin(t)]++
+}
+
+// bin returns the index of the bucket which t falls into.
+func (d *DistroGraph) bin(t time.Duration) int {
+	if !d.linear {
+		return expBin(t)
+	}
 	idx := 0
-	if d.linear {
-		for i := d.lower; i < d.upper; i += d.interval {
-			if t <= i {
-				d.Bins[idx]++
-				return
-			}
-			idx++
+	for i := d.lower; i < d.upper; i += d.interval {
+		if t <= i {
+			return idx
 		}
-		/* ---- Account for this value in the last bucket ---- */
-		d.Bins[idx-1]++
-	} else {
-		v := int64(t)
-		i := 0
-		for v != 0 {
-			v = v >> 1
-			i++
+		idx++
+	}
+	/* ---- Account for this value in the last bucket ---- */
+	return idx - 1
+}
+
+// expBin is the bucket for t in the default exponential graph. Bucket i holds
+// values from 2^(i-1) up to 2^i.
+func expBin(t time.Duration) int {
+	v := int64(t)
+	i := 0
+	for v != 0 {
+		v = v >> 1
+		i++
+	}
+	return i
+}
+
+func (d *DistroGraph) Clear() {
+	for k := range d.Bins {
+		d.Bins[k] = 0
+	}
+}
+
+func (d *DistroGraph) Count() int64 {
+	count := int64(0)
+	for _, v := range d.Bins {
+		count += v
+	}
+	return count
+}
+
+/*
+ * Percentile -- find the latency below which pct percent of the samples fall
+ *
+ * The histogram only knows which bucket a sample landed in. For the exponential
+ * graph bucket i holds values from 2^(i-1) up to 2^i so the value is interpolated
+ * within the bucket. For linear graphs the upper edge of the bucket is returned.
+ */
+func (d *DistroGraph) Percentile(pct float64) time.Duration {
+	total := d.Count()
+	if total == 0 {
+		return 0
+	}
+	target := float64(total) * pct / 100.0
+	seen := int64(0)
+	for k, v := range d.Bins {
+		if v == 0 || float64(seen+v) < target {
+			seen += v
+			continue
+		}
+		if d.linear {
+			return d.lower + time.Duration(k)*d.interval
+		}
+		if k == 0 {
+			return 0
 		}
-		d.Bins[i]++
+		low := math.Pow(2, float64(k-1))
+		return time.Duration(low + low*(target-float64(seen))/float64(v))
 	}
+	return 0
 }
 
 func (d *DistroGraph) print(useGroup bool, format string, a ...interface{}) {
@@ -0,0 +1,41 @@
+package support
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	d := DistroInit(nil, "")
+	if p := d.Percentile(99); p != 0 {
+		t.Errorf("empty graph P99 %s", p)
+	}
+
+	// 90 I/O's in the 512ns-1024ns bucket and 10 in 512us-1.05ms. The
+	// position within a bucket is interpolated.
+	for i := 0; i < 90; i++ {
+		d.Aggregate(1000 * time.Nanosecond)
+	}
+	for i := 0; i < 10; i++ {
+		d.Aggregate(time.Millisecond)
+	}
+	for _, c := range []struct {
+		pct  float64
+		want time.Duration
+	}{{50, 796}, {90, 1024}, {99, 996147}, {100, 1048576}} {
+		if got := d.Percentile(c.pct); got != c.want {
+			t.Errorf("P%g = %d, want %d", c.pct, got, c.want)
+		}
+	}
+
+	// A linear graph gives the bucket, values past the end are in the last.
+	l := DistroInit(nil, "")
+	l.CreateLinear(4*time.Microsecond, 20*time.Microsecond, time.Microsecond)
+	for i := 0; i < 9; i++ {
+		l.Aggregate(5 * time.Microsecond)
+	}
+	l.Aggregate(time.Millisecond)
+	if p50, p99 := l.Percentile(50), l.Percentile(99); p50 != 5*time.Microsecond || p99 != 19*time.Microsecond {
+		t.Errorf("linear P50 %s, P99 %s", p50, p99)
+	}
+}
@@ -0,0 +1,188 @@
+package support
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+)
+
+// Size of every chart in the HTML report. The plot area is inset by chartPad
+// to leave room for the axis labels.
+const (
+	chartWidth  = 720
+	chartHeight = 240
+	chartPad    = 50
+)
+
+//
+// WriteHTMLReport -- the results as one self contained page for fiod -html
+//
+// Everything, including the charts which are inline SVG, is in the one file
+// so the report can be attached to a ticket or mailed without anything else.
+// Each job gets its latency histogram, IOPS and bandwidth over the run, and
+// the per-section, CPU and device numbers where there are any.
+//
+func WriteHTMLReport(filename string, report *Report) error {
+	var b bytes.Buffer
+	if err := htmlReport.Execute(&b, report); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b.Bytes(), 0666)
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"human":     func(v int64) string { return strings.TrimSpace(Humanize(v, 1)) },
+	"histogram": histogramSVG,
+	"rates":     ratesSVG,
+	"stamp":     func(t time.Time) string { return t.Format(time.RFC1123) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>fiod report {{.JobFile}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #bbb; padding: 3px 8px; text-align: right; }
+th { background: #eee; }
+td:first-child, th:first-child { text-align: left; }
+svg { display: block; margin: 1em 0; }
+.note { color: #555; }
+</style>
+</head>
+<body>
+<h1>fiod report</h1>
+<p class="note">Job file {{.JobFile}}, created {{stamp .Created}}</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Job</th><th>Runtime</th><th>IOPS</th><th>BW</th><th>Read Lat</th><th>Write Lat</th>
+<th>P50</th><th>P90</th><th>P99</th><th>P99.9</th><th>Stopped by</th></tr>
+{{range .Jobs}}<tr><td><a href="#{{.Name}}">{{.Name}}</a>{{if .Label}} {{.Label}}{{end}}</td><td>{{.Runtime}}</td>
+<td>{{human .IOPS}}</td><td>{{human .BW}}</td><td>{{.ReadLatAvg}}</td><td>{{.WriteLatAvg}}</td>
+<td>{{.Latency.P50}}</td><td>{{.Latency.P90}}</td><td>{{.Latency.P99}}</td><td>{{.Latency.P999}}</td>
+<td>{{.StopReason}}</td></tr>
+{{end}}</table>
+{{range .Jobs}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p>{{human .ReadIOs}} reads, {{human .WriteIOs}} writes, {{human .ReadBytes}} read, {{human .WriteBytes}} written.
+Read {{human .ReadBW}}/s, write {{human .WriteBW}}/s.</p>
+{{if .CPU}}<p>CPU: {{.CPU}}</p>{{end}}
+{{if .Device}}<p>Device {{.Device}}</p>{{end}}
+{{if .SteadyState}}<p>Steady state on {{.SteadyState.Metric}}: reached {{.SteadyState.Reached}},
+deviation {{printf "%.2f" .SteadyState.Deviation}}%</p>{{end}}
+{{histogram .Histogram}}
+{{rates .Intervals}}
+{{if .Sections}}<table>
+<tr><th>Section</th><th>Op</th><th>Block</th><th>Range</th><th>IOPS</th><th>BW</th><th>Read Lat</th>
+<th>Write Lat</th><th>P99</th></tr>
+{{range .Sections}}<tr><td>{{.Index}}</td><td>{{.Op}}</td><td>{{.BlockSize}}</td>
+<td>{{human .Start}}-{{human .End}}</td><td>{{human .IOPS}}</td><td>{{human .BW}}</td>
+<td>{{.ReadLatAvg}}</td><td>{{.WriteLatAvg}}</td><td>{{.Latency.P99}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// svgStart opens a chart with its title and axes.
+func svgStart(b *bytes.Buffer, title string) {
+	_, _ = fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="11">`,
+		chartWidth, chartHeight)
+	_, _ = fmt.Fprintf(b, `<text x="%d" y="16" font-size="13">%s</text>`, chartPad, html.EscapeString(title))
+	_, _ = fmt.Fprintf(b, `<path d="M%d %d V%d H%d" stroke="#444" fill="none"/>`, chartPad, chartPad/2,
+		chartHeight-chartPad, chartWidth-chartPad/2)
+}
+
+// histogramSVG draws the exponential latency histogram as bars, trimmed to
+// the buckets which have something in them. Each bar is labelled with the
+// top of its bucket.
+func histogramSVG(bins []int64) template.HTML {
+	first, last := -1, -1
+	var most int64
+	for i, v := range bins {
+		if v != 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+		if v > most {
+			most = v
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	svgStart(&b, "Latency histogram")
+	n := last - first + 1
+	plotW := float64(chartWidth - chartPad - chartPad/2)
+	plotH := float64(chartHeight - chartPad - chartPad/2)
+	barW := plotW / float64(n)
+	for i := first; i <= last; i++ {
+		x := float64(chartPad) + float64(i-first)*barW
+		h := float64(bins[i]) / float64(most) * plotH
+		_, _ = fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4a7ebb">`+
+			`<title>%s: %d</title></rect>`, x+1, float64(chartHeight-chartPad)-h, math.Max(barW-2, 1), h,
+			time.Duration(int64(1)<<uint(i)), bins[i])
+		_, _ = fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="end" transform="rotate(-45 %.1f %d)">%s</text>`,
+			x+barW/2, chartHeight-chartPad+12, x+barW/2, chartHeight-chartPad+12,
+			time.Duration(int64(1)<<uint(i)))
+	}
+	_, _ = fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%d</text>`, chartPad-4, chartPad/2+8, most)
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// ratesSVG draws IOPS and bandwidth over the run as two lines, each scaled
+// to its own maximum which is shown on its side of the chart.
+func ratesSVG(samples []IntervalSample) template.HTML {
+	if len(samples) < 2 {
+		return ""
+	}
+	var maxIOPS, maxBW int64
+	for _, s := range samples {
+		if s.IOPS > maxIOPS {
+			maxIOPS = s.IOPS
+		}
+		if s.BW > maxBW {
+			maxBW = s.BW
+		}
+	}
+	end := samples[len(samples)-1].Elapsed
+	plotW := float64(chartWidth - chartPad - chartPad/2)
+	plotH := float64(chartHeight - chartPad - chartPad/2)
+	line := func(value func(IntervalSample) int64, most int64) string {
+		var pts []string
+		for _, s := range samples {
+			y := 0.0
+			if most != 0 {
+				y = float64(value(s)) / float64(most) * plotH
+			}
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", float64(chartPad)+float64(s.Elapsed)/float64(end)*plotW,
+				float64(chartHeight-chartPad)-y))
+		}
+		return strings.Join(pts, " ")
+	}
+
+	var b bytes.Buffer
+	svgStart(&b, "IOPS (blue) and bandwidth (orange) per interval")
+	_, _ = fmt.Fprintf(&b, `<polyline points="%s" stroke="#4a7ebb" stroke-width="2" fill="none"/>`,
+		line(func(s IntervalSample) int64 { return s.IOPS }, maxIOPS))
+	_, _ = fmt.Fprintf(&b, `<polyline points="%s" stroke="#e08a2c" stroke-width="2" fill="none"/>`,
+		line(func(s IntervalSample) int64 { return s.BW }, maxBW))
+	_, _ = fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#4a7ebb">%s</text>`, chartPad-4,
+		chartPad/2+8, strings.TrimSpace(Humanize(maxIOPS, 1)))
+	_, _ = fmt.Fprintf(&b, `<text x="%d" y="16" text-anchor="end" fill="#e08a2c">%s/s</text>`,
+		chartWidth-chartPad/2, strings.TrimSpace(Humanize(maxBW, 1)))
+	_, _ = fmt.Fprintf(&b, `<text x="%d" y="%d">0</text>`, chartPad, chartHeight-chartPad+14)
+	_, _ = fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth-chartPad/2,
+		chartHeight-chartPad+14, end.Round(time.Second))
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
@@ -0,0 +1,59 @@
+package support
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fiod-html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bins := make([]int64, 64)
+	bins[10], bins[11], bins[14] = 5, 20, 1
+	report := &Report{Version: 1, JobFile: "nightly.j", Created: time.Now(), Jobs: []*JobResult{
+		{Name: "read<1>", IOPS: 1000, Histogram: bins, Latency: LatencyPercentiles{P99: 8 * time.Microsecond},
+			Intervals: []IntervalSample{{time.Second, 900, 1 << 20}, {2 * time.Second, 1100, 2 << 20}}},
+		{Name: "idle"},
+	}}
+	name := filepath.Join(dir, "report.html")
+	if err := WriteHTMLReport(name, report); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+
+	// Only the job with numbers gets charts, and they must stand alone.
+	svgs := regexp.MustCompile(`(?s)<svg.*?</svg>`).FindAllString(page, -1)
+	if len(svgs) != 2 {
+		t.Fatalf("%d charts", len(svgs))
+	}
+	for _, svg := range svgs {
+		if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+			t.Errorf("chart isn't valid SVG: %s", err)
+		}
+	}
+	if strings.Count(svgs[0], "<rect") != 5 || !strings.Contains(svgs[0], "1.024µs: 5") {
+		t.Errorf("histogram should have a bar for buckets 10 to 14:\n%s", svgs[0])
+	}
+	if strings.Contains(page, "read<1>") || !strings.Contains(page, "read&lt;1&gt;") {
+		t.Error("job name wasn't escaped")
+	}
+	for _, ref := range []string{"src=", `href="http`, "<link", "<script", "url("} {
+		if strings.Contains(page, ref) {
+			t.Errorf("report refers to something outside the file with %s", ref)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package support
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -14,7 +18,10 @@ import (
 type AccessData struct {
 	blk int64
 	op  int
-	len	int64
+	len int64
+
+	// Index of the access pattern section the I/O came from.
+	section int
 }
 
 type JobReport struct {
@@ -26,23 +33,132 @@ type JobReport struct {
 	WriteIOs    int
 }
 
+// StopReason is the condition which ended a job.
+type StopReason int32
+
+const (
+	StopNone StopReason = iota
+	StopRuntime
+	StopIOLimit
+	StopNumberIOs
+	StopLoops
+	StopSteadyState
+	StopAborted
+	StopError
+	StopTimeout
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopRuntime:
+		return "runtime"
+	case StopIOLimit:
+		return "io-limit"
+	case StopNumberIOs:
+		return "number-ios"
+	case StopLoops:
+		return "loops"
+	case StopSteadyState:
+		return "steady-state"
+	case StopAborted:
+		return "stopped"
+	case StopError:
+		return "error"
+	case StopTimeout:
+		return "io-timeout"
+	}
+	return "none"
+}
+
+// NullTarget used as the name of a job runs it without a file or device. Writes
+// are thrown away and reads leave the buffer as it was, which shows how many
+// I/O's fiod itself can generate and account for.
+const NullTarget = "null"
+
+// target is where a job sends its I/O.
+type target interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error
+}
+
+type nullTarget struct{}
+
+func (nullTarget) ReadAt(p []byte, off int64) (int, error)  { return len(p), nil }
+func (nullTarget) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+func (nullTarget) Sync() error                              { return nil }
+
+// JobState is where a job is in its life. Workers check it before each I/O.
+type JobState int32
+
+const (
+	JobPrepared JobState = iota + 1 // Set up by JobInit, may be filling the target
+	JobRunning
+	JobDraining // Halted, the workers are finishing the I/O they have
+	JobDone
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobPrepared:
+		return "prepared"
+	case JobRunning:
+		return "running"
+	case JobDraining:
+		return "draining"
+	case JobDone:
+		return "done"
+	}
+	return "unknown"
+}
+
 type Job struct {
 	TargetName   string
 	JobParams    *JobData
 	Stats        *StatsState
 	pathName     string
 	fp           *os.File
+	target       target
+	logFp        *os.File
 	lastErr      error
-	lcgPattern   *RandLCG
 	lcgBlk       *RandLCG
-	threadRun    bool
+	ramping      int32
 	remove       bool
 	nextBlks     chan AccessData
 	thrCompletes chan JobReport
 	bailOnError  bool
 	statIdx      int
-	validInit    bool
-	startTime    time.Time
+	jobStat      *jobStats
+
+	// state and stopReason are changed with atomics. Halting a job also
+	// cancels the context of the fill or run which is going on, mu keeps
+	// that in step with begin() and end().
+	mu         sync.Mutex
+	state      int32
+	stopReason int32
+	cancel     context.CancelFunc
+
+	// Shared by the workers while the job runs. sections is a copy of the
+	// access pattern which is only read, cursors is the sequential position
+	// within each section.
+	sections    []AccessPattern
+	cursors     []int64
+	mapLock     sync.Mutex
+	issuedIOs   int64
+	issuedBytes int64
+
+	// For loops, the bytes issued to each section and the number of
+	// sections which haven't had all of their passes yet.
+	sectionBytes []int64
+	loopsLeft    int64
+
+	// I/O buffers for reads and verify writes.
+	bufs bufPool
+
+	// What each worker is waiting on when io-timeout is set.
+	slots     []ioSlot
+	validInit bool
+	startTime time.Time
 }
 
 func JobInit(name string, jd *JobData, stats *StatsState) (*Job, error) {
@@ -52,80 +168,130 @@ func JobInit(name string, jd *JobData, stats *StatsState) (*Job, error) {
 	openFlags := os.O_RDWR
 	// Used when writing out validation blocks
 	j.startTime = time.Now()
-	if jd.Name[0] == '/' {
-		j.pathName = jd.Name
-	} else {
-		j.pathName = jd.Directory + "/" + jd.Name
-	}
-	if _, err := os.Stat(j.pathName); err == nil {
-		j.remove = false
+	j.pathName = jd.targetPath()
+	if jd.isNull() {
+		j.target = nullTarget{}
+	} else if fi, err := os.Stat(j.pathName); err == nil {
+		if err := guardTarget(j.pathName, fi, jd); err != nil {
+			return nil, err
+		}
+		// Jobs from a sweep share the target. If the first one created it
+		// the last one cleans up.
+		j.remove = jd.sweepCreated != nil && *jd.sweepCreated && jd.sweepLast && !jd.Save_On_Create
 	} else {
 		j.remove = !j.JobParams.Save_On_Create
+		if jd.sweepCreated != nil {
+			*jd.sweepCreated = true
+			j.remove = j.remove && jd.sweepLast
+		}
 		openFlags |= os.O_CREATE
 	}
-	if j.fp, j.lastErr = os.OpenFile(j.pathName, openFlags, 0666); j.lastErr != nil {
-		return nil, j.lastErr
+	if j.target == nil {
+		if j.fp, j.lastErr = os.OpenFile(j.pathName, openFlags, 0666); j.lastErr != nil {
+			return nil, j.lastErr
+		}
+		j.target = j.fp
 	}
-	j.thrCompletes = make(chan JobReport)
+	// Room for every worker so one the io-timeout watchdog gave up on
+	// doesn't block should its I/O ever return.
+	j.thrCompletes = make(chan JobReport, jd.IODepth)
 	j.nextBlks = make(chan AccessData, 1000)
-	j.lcgPattern = new(RandLCG)
-	j.lcgPattern.Init()
 	j.lcgBlk = new(RandLCG)
 	j.lcgBlk.Init()
-	j.threadRun = false
+	j.state = int32(JobPrepared)
 	j.bailOnError = true
-	if fileinfo, err := j.fp.Stat(); err == nil {
-		if fileinfo.Mode().IsRegular() {
-			if j.JobParams.fileSize == 0 {
-				j.JobParams.fileSize = fileinfo.Size()
-				j.JobParams.Size = Humanize(j.JobParams.fileSize, 1)
-			}
-		} else {
-			if pos, err := j.fp.Seek(0, 2); err != nil {
-				return nil, err
-			} else {
-				// Override the size of the device with what the user specified.
-				if j.JobParams.fileSize != 0 {
-					pos = j.JobParams.fileSize
-				}
-				if pos == 0 {
-					return nil, fmt.Errorf("can't find the size of device")
-				}
-				j.JobParams.fileSize = pos
-			}
+	if j.fp != nil {
+		if size, err := targetSize(j.fp, j.JobParams); err == nil {
+			j.JobParams.fileSize = size
 			j.JobParams.Size = Humanize(j.JobParams.fileSize, 1)
-
+		} else {
+			return nil, err
 		}
-	} else {
-		return nil, err
 	}
 
 	if j.JobParams.Verbose {
 		j.statIdx = j.Stats.NextHistogramIdx()
 		j.Stats.Send(StatsRecord{OpType: StatSetHistogram, opSize: j.JobParams.fileSize, opIdx: j.statIdx})
 	}
-
-	currentBlk := int64(0)
-	for e := j.JobParams.accessPattern.Front(); e != nil; e = e.Next() {
-		access := e.Value.(AccessPattern)
-		access.sectionStart = currentBlk
-		access.lastBlk = currentBlk
-		currentBlk += j.JobParams.fileSize * int64(access.sectionPercent) / 100
-		access.sectionEnd = currentBlk - access.blkSize
-		e.Value = access
+	if j.JobParams.logInterval > 0 {
+		logName := j.JobParams.Log_File
+		if logName == "" {
+			logName = name + ".csv"
+		}
+		if j.logFp, j.lastErr = os.OpenFile(logName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666); j.lastErr != nil {
+			return nil, j.lastErr
+		}
 	}
+	var logw io.Writer
+	if j.logFp != nil {
+		logw = j.logFp
+	}
+	j.jobStat = newJobStats(name, jd, func() { j.halt(StopSteadyState) }, logw)
+	j.jobStat.addShards(jd.IODepth, j.Stats.latency)
+	j.jobStat.bufs = &j.bufs
+	if !jd.isNull() {
+		if j.jobStat.disk = newDiskSampler(j.pathName); j.jobStat.disk != nil {
+			j.jobStat.disk.reset(j.jobStat.startTime)
+		}
+	}
+	j.Stats.Send(StatsRecord{OpType: StatAddJob, job: j.jobStat})
 
+	if err := j.JobParams.layoutSections(); err != nil {
+		return nil, err
+	}
 	j.validInit = true
 	return j, nil
 }
 
+func (jd *JobData) targetPath() string {
+	if jd.isNull() {
+		return NullTarget
+	}
+	if jd.Name[0] == '/' {
+		return jd.Name
+	}
+	return jd.Directory + "/" + jd.Name
+}
+
+// targetSize returns the number of bytes the job will use on the open target.
+// For regular files that's either the requested size or the current size of the
+// file. Devices use their full size unless the job asks for less.
+func targetSize(fp *os.File, jd *JobData) (int64, error) {
+	fileinfo, err := fp.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fileinfo.Mode().IsRegular() {
+		if jd.fileSize == 0 {
+			return fileinfo.Size(), nil
+		}
+		return jd.fileSize, nil
+	}
+	pos, err := fp.Seek(0, 2)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = fp.Seek(0, 0)
+	// Override the size of the device with what the user specified.
+	if jd.fileSize != 0 {
+		pos = jd.fileSize
+	}
+	if pos == 0 {
+		return 0, fmt.Errorf("can't find the size of device")
+	}
+	return pos, nil
+}
+
 func (j *Job) FillAsNeeded(tracker *tracking) error {
 	var fileinfo  os.FileInfo
 
+	if j.fp == nil {
+		return nil
+	}
 	if fileinfo, j.lastErr = j.fp.Stat(); j.lastErr == nil {
 		if fileinfo.Mode().IsRegular() {
 			if fileinfo.Size() < j.JobParams.fileSize {
-				j.fileFill(tracker)
+				j.lastErr = j.fileFill(tracker)
 				if j.lastErr == nil {
 					_, _ = j.fp.Seek(0, 0)
 					tracker.UpdateName(j.TargetName, "(syncing)")
@@ -145,14 +311,13 @@ func (j *Job) FillAsNeeded(tracker *tracking) error {
 			// some variant of a verify operation which will need the data pattern
 			// correctly laid out on the device.
 			if j.JobParams.Force_Fill {
-				j.fileFill(tracker)
+				j.lastErr = j.fileFill(tracker)
 			}
 
 			_, _ = j.fp.Seek(0, 0)
 		}
 	}
 
-	// lastErr can also be set by calling AbortPrep()
 	return j.lastErr
 }
 
@@ -180,55 +345,194 @@ func (j *Job) GetJobdata() *JobData {
 	return j.JobParams
 }
 
-func (j *Job) Start() {
-	thrExit := 0
+//
+// Start -- run the job until one of its termination conditions is met
+//
+// The job ends when runtime expires, io-limit bytes or number-ios I/O's have been
+// issued, loops passes over the access pattern have been made, steady state is
+// reached, an I/O fails, or Stop() is called. Whichever happens first is returned.
+//
+func (j *Job) Start() StopReason {
+	return j.run(func(workId int) func() AccessData {
+		return j.newAccessGen(workId).next
+	})
+}
+
+// run is Start() with source giving each worker the function it gets its I/O
+// requests from. The benchmarks use it to compare against feeding every worker
+// from one generator over a channel.
+func (j *Job) run(source func(workId int) func() AccessData) StopReason {
 	keepRunning := true
 	finalReport := JobReport{ReadErrors: 0, WriteErrors: 0, Name: j.TargetName}
 
 	if j.validInit == false {
-		return
+		return StopError
 	}
-	j.threadRun = true
-	boom := time.After(j.JobParams.runtime)
+	ctx := j.begin(JobRunning)
+	// The runtime is measured from the end of the ramp so that the reported
+	// numbers cover the full runtime requested.
+	boom := time.NewTimer(j.JobParams.runtime + j.JobParams.rampTime)
+	defer boom.Stop()
 
 	if j.JobParams.delayStart > 0 {
-		time.Sleep(j.JobParams.delayStart)
+		select {
+		case <-time.After(j.JobParams.delayStart):
+		case <-ctx.Done():
+		}
+	}
+
+	var logTick <-chan time.Time
+	if j.JobParams.logInterval > 0 {
+		ticker := time.NewTicker(j.JobParams.logInterval)
+		defer ticker.Stop()
+		logTick = ticker.C
+	}
+
+	var rampDone <-chan time.Time
+	if j.JobParams.rampTime > 0 {
+		atomic.StoreInt32(&j.ramping, 1)
+		rampDone = time.After(j.JobParams.rampTime)
+	}
+
+	j.sections, j.cursors = nil, nil
+	for e := j.JobParams.accessPattern.Front(); e != nil; e = e.Next() {
+		access := e.Value.(AccessPattern)
+		j.sections = append(j.sections, access)
+		j.cursors = append(j.cursors, access.lastBlk)
+	}
+	j.resetLimits()
+
+	// Workers which have finished or been given up on by the watchdog.
+	running := j.JobParams.IODepth
+	exited := make([]bool, j.JobParams.IODepth)
+	abandoned := 0
+	var watchTick <-chan time.Time
+	j.slots = nil
+	if j.JobParams.ioTimeout > 0 {
+		j.slots = make([]ioSlot, j.JobParams.IODepth)
+		ticker := time.NewTicker(j.watchInterval())
+		defer ticker.Stop()
+		watchTick = ticker.C
 	}
 
-	go j.genAccessData()
 	for i := 0; i < j.JobParams.IODepth; i++ {
-		go j.ioWorker(i)
+		go j.ioWorker(i, source(i))
 	}
 
 	for keepRunning {
 		select {
 		case rpt := <-j.thrCompletes:
+			if exited[rpt.JobID] {
+				// Given up on by the watchdog, its I/O has come back.
+				break
+			}
+			exited[rpt.JobID] = true
 			finalReport.ReadErrors += rpt.ReadErrors
 			finalReport.WriteErrors += rpt.WriteErrors
 			finalReport.ReadIOs += rpt.ReadIOs
 			finalReport.WriteIOs += rpt.WriteIOs
-			thrExit++
-			if thrExit == j.JobParams.IODepth {
-				// Once all of the ioWorker threads and generation thread
-				// have been collected end the loop here so that the
-				// main loop can collect the threads it's waiting
-				// for.
+			running--
+			if running == 0 {
+				// Once all of the ioWorker threads have been collected
+				// end the loop here so that the main loop can collect
+				// the threads it's waiting for.
 				keepRunning = false
 				break
 			}
-		case <-boom:
-			// By setting threadRun to false genAccessData() will stop
-			// generating access data and send IODepth number of Stop
-			// requests down the channel. That it turn will cause the
+		case <-watchTick:
+			// A stuck I/O counts as a failed one.
+			for _, w := range j.watchdog(time.Now()) {
+				if !exited[w] {
+					exited[w] = true
+					abandoned++
+					running--
+				}
+			}
+			keepRunning = running > 0
+		case <-logTick:
+			j.Stats.Send(StatsRecord{OpType: StatLogInterval, job: j.jobStat})
+		case <-rampDone:
+			// Workers record into their shards as soon as ramping is
+			// off so the stats thread has to see the ramp end first.
+			j.Stats.Send(StatsRecord{OpType: StatRampDone, job: j.jobStat})
+			j.Stats.Flush()
+			atomic.StoreInt32(&j.ramping, 0)
+		case <-boom.C:
+			// Once the job is draining each worker's generator will
+			// hand it a Stop request which in turn will cause the
 			// workers to stop.
-			j.threadRun = false
-			break
+			j.halt(StopRuntime)
 		}
 	}
+	// A later Start() continues where the sequential sections left off.
+	idx := 0
+	for e := j.JobParams.accessPattern.Front(); e != nil; e = e.Next() {
+		access := e.Value.(AccessPattern)
+		access.lastBlk = j.cursors[idx]
+		e.Value = access
+		idx++
+	}
+	j.end(JobDone)
+	reason := j.reason()
+	// opSize carries the number of failed I/O's.
+	j.Stats.Send(StatsRecord{OpType: StatJobDone, job: j.jobStat, opStr: reason.String(),
+		opSize: int64(finalReport.ReadErrors + finalReport.WriteErrors + abandoned)})
+	return reason
+}
+
+// State returns where the job is in its life.
+func (j *Job) State() JobState {
+	return JobState(atomic.LoadInt32(&j.state))
+}
+
+func (j *Job) reason() StopReason {
+	return StopReason(atomic.LoadInt32(&j.stopReason))
+}
+
+// begin starts filling or running the job with a new context. If the job was
+// halted before it got here the context is cancelled at once.
+func (j *Job) begin(state JobState) context.Context {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var ctx context.Context
+	ctx, j.cancel = context.WithCancel(context.Background())
+	if j.reason() != StopNone {
+		j.cancel()
+		if state == JobRunning {
+			state = JobDraining
+		}
+	}
+	atomic.StoreInt32(&j.state, int32(state))
+	return ctx
+}
+
+// end is called once every worker started by begin has finished.
+func (j *Job) end(state JobState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cancel()
+	atomic.StoreInt32(&j.state, int32(state))
+}
+
+// halt stops the job recording why. Only the first reason is kept. Safe to
+// call from any goroutine at any time.
+func (j *Job) halt(reason StopReason) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	atomic.CompareAndSwapInt32(&j.stopReason, int32(StopNone), int32(reason))
+	atomic.CompareAndSwapInt32(&j.state, int32(JobRunning), int32(JobDraining))
+	if j.cancel != nil {
+		j.cancel()
+	}
 }
 
 func (j *Job) Fini() {
-	_ = j.fp.Close()
+	if j.fp != nil {
+		_ = j.fp.Close()
+	}
+	if j.logFp != nil {
+		_ = j.logFp.Close()
+	}
 	if j.remove {
 		_ = os.Remove(j.pathName)
 	}
@@ -242,7 +546,9 @@ func (j *Job) Error() string {
 // | Non public class methods										|
 // []--------------------------------------------------------------[]
 
-func (j *Job) patternFill(bp []byte) {
+// patternFill fills bp with data. Each worker passes its own lcg since the
+// generator isn't safe to share.
+func (j *Job) patternFill(bp []byte, lcg *RandLCG) {
 	var up *int64
 	var engine func()int64
 
@@ -250,7 +556,7 @@ func (j *Job) patternFill(bp []byte) {
 	case j.JobParams.Block_Pattern == PatternRand:
 		engine = rand.Int63
 	case j.JobParams.Block_Pattern == PatternLCG:
-		engine = j.lcgPattern.Value63
+		engine = lcg.Value63
 	}
 
 	slice := (*reflect.SliceHeader)(unsafe.Pointer(&bp))
@@ -260,96 +566,219 @@ func (j *Job) patternFill(bp []byte) {
 	}
 }
 
-func (j *Job) genAccessData() {
-	for j.threadRun {
-		j.nextBlks <- j.oneAD()
+//
+// accessGen -- creates the I/O requests for a single worker
+//
+// Each worker has its own random source so that workers don't contend for the
+// lock inside math/rand or wait on a single generation thread. The sequential
+// position in each section, the random maps, and the count of I/O's issued are
+// shared through the Job so every worker still honours the access pattern.
+//
+type accessGen struct {
+	j      *Job
+	workId int
+	rnd    *rand.Rand
+
+	// Position of this worker's stream in each +seq-per-worker section.
+	streams map[int]int64
+}
+
+func (j *Job) newAccessGen(workId int) *accessGen {
+	return &accessGen{j: j, workId: workId, rnd: rand.New(rand.NewSource(rand.Int63())),
+		streams: map[int]int64{}}
+}
+
+// next returns the worker's next I/O. Once the job has been halted, or one of
+// its limits has been reached, a StopType request is returned instead.
+func (g *accessGen) next() AccessData {
+	j := g.j
+	for j.State() == JobRunning {
+		ad := g.oneAD()
+		if ad.op == NoneType {
+			continue
+		}
+		if j.passesDone(ad.section) && atomic.LoadInt64(&j.loopsLeft) > 0 {
+			// The section sits out until the others have caught up.
+			continue
+		}
+		if reason := j.reserve(ad.section, ad.len); reason != StopNone {
+			j.halt(reason)
+			break
+		}
+		return ad
 	}
+	return AccessData{op: StopType}
+}
 
-	for i := 0; i < j.JobParams.IODepth; i++ {
-		j.nextBlks <- AccessData{0, StopType, 0}
+// resetLimits starts the counts for io-limit, number-ios and loops over.
+func (j *Job) resetLimits() {
+	j.issuedIOs, j.issuedBytes = 0, 0
+	j.sectionBytes = make([]int64, len(j.sections))
+	j.loopsLeft = 0
+	for _, access := range j.sections {
+		if access.opType != NoneType {
+			j.loopsLeft++
+		}
 	}
 }
 
-func (j *Job) oneAD() AccessData {
+// reserve counts an I/O against the limits of the job before it's issued. Once
+// a limit has been met the I/O is refused along with every one after it, so
+// number-ios is exact while the I/O which takes the job past io-limit is still
+// issued. Like the statistics, nothing issued during the ramp counts.
+func (j *Job) reserve(section int, size int64) StopReason {
+	if !j.JobParams.limited() || atomic.LoadInt32(&j.ramping) != 0 {
+		return StopNone
+	}
+	ios := atomic.AddInt64(&j.issuedIOs, 1)
+	bytes := atomic.AddInt64(&j.issuedBytes, size)
+	if reason := j.JobParams.limitReached(ios-1, bytes-size); reason != StopNone {
+		return reason
+	}
+	return j.countLoop(section, size)
+}
+
+// countLoop tracks the passes made over each section for loops. The job is
+// done once every section has had that many, see passesDone for the sections
+// which get there first.
+func (j *Job) countLoop(section int, size int64) StopReason {
+	if j.JobParams.Loops <= 0 {
+		return StopNone
+	}
+	if atomic.LoadInt64(&j.loopsLeft) <= 0 {
+		return StopLoops
+	}
+	target := j.sections[section].weight * int64(j.JobParams.Loops)
+	if done := atomic.AddInt64(&j.sectionBytes[section], size); done >= target && done-size < target {
+		atomic.AddInt64(&j.loopsLeft, -1)
+	}
+	return StopNone
+}
+
+// passesDone is true once section has had its passes for loops. Workers which
+// pick it then pick again, so a fast section doesn't keep going while a slow
+// one catches up. A worker which picked it just before may still add an I/O.
+func (j *Job) passesDone(section int) bool {
+	return j.JobParams.Loops > 0 &&
+		atomic.LoadInt64(&j.sectionBytes[section]) >= j.sections[section].weight*int64(j.JobParams.Loops)
+}
+
+func (g *accessGen) oneAD() AccessData {
+	j := g.j
 	ad := AccessData{}
-	section := rand.Intn(100)
-	for e := j.JobParams.accessPattern.Front(); e != nil; e = e.Next() {
-		access := e.Value.(AccessPattern)
-		// If the current requeted section is less than the percentage
+	section := g.rnd.Int63n(j.JobParams.accessWeight)
+	for idx := range j.sections {
+		access := &j.sections[idx]
+		// If the current requeted section is less than the size
 		// of the section being worked on we've found range to work with.
 		// Otherwise, subtract the current range from the section and
 		// go to the next one.
-		if access.sectionPercent > section {
-			ad.len = access.blkSize
-			// Generate the block number for the next request.
-			switch access.opType {
-			case ReadSeqType, WriteSeqType, RwseqType, ReadSeqVerifyType:
-				access.lastBlk += access.blkSize
-				if access.lastBlk >= access.sectionEnd {
-					access.lastBlk = access.sectionStart
-				}
-				ad.blk = access.lastBlk
+		if access.weight <= section {
+			section -= access.weight
+			continue
+		}
+		ad.len = access.nextBlkSize(g.rnd)
+		ad.section = idx
+		// Generate the block number for the next request.
+		switch access.opType {
+		case ReadSeqType, WriteSeqType, RwseqType, ReadSeqVerifyType:
+			if access.perWorker {
+				ad.blk = g.streamBlk(idx, ad.len)
+			} else {
+				ad.blk = j.seqBlk(idx, ad.len)
+			}
 
-			case ReadRandType, WriteRandType, RwrandType, RwrandVerifyType:
-				randBlk := rand.Int63n((access.sectionEnd - access.sectionStart - ad.len) / 512)
+		case ReadRandType, WriteRandType, RwrandType, RwrandVerifyType:
+			if m := access.randMap; m != nil {
+				j.mapLock.Lock()
+				ad.blk = m.next(g.rnd.Int63n(m.blocks))*access.blkSize + access.sectionStart
+				j.mapLock.Unlock()
+			} else {
+				randBlk := g.rnd.Int63n((access.sectionEnd - access.sectionStart - ad.len) / 512)
 				ad.blk = randBlk*512 + access.sectionStart
-
-			case NoneType:
-				ad.blk = 0
-
-			default:
-				fmt.Printf("\nInvalid opType=%d ... should be impossible\n", access.opType)
-				os.Exit(1)
 			}
 
-			// We get a copy of the element stored in the list. So, update the element
-			// with any changes that have been made.
-			e.Value = access
+		case NoneType:
+			ad.blk = 0
 
-			// Now set the op type.
-			switch access.opType {
-			case ReadRandType, ReadSeqType:
-				ad.op = ReadBaseType
+		default:
+			fmt.Printf("\nInvalid opType=%d ... should be impossible\n", access.opType)
+			os.Exit(1)
+		}
 
-			case ReadSeqVerifyType:
-				ad.op = ReadBaseVerifyType
+		// Now set the op type.
+		switch access.opType {
+		case ReadRandType, ReadSeqType:
+			ad.op = ReadBaseType
 
-			case WriteRandType, WriteSeqType:
-				ad.op = WriteBaseType
+		case ReadSeqVerifyType:
+			ad.op = ReadBaseVerifyType
 
-			case RwseqType, RwrandType:
-				if rand.Intn(100) < access.readPercent {
-					ad.op = ReadBaseType
-				} else {
-					ad.op = WriteBaseType
-				}
+		case WriteRandType, WriteSeqType:
+			ad.op = WriteBaseType
 
-			case RwrandVerifyType:
-				if rand.Intn(100) < access.readPercent {
-					ad.op = ReadBaseVerifyType
-				} else {
-					ad.op = WriteBaseVerifyType
-				}
+		case RwseqType, RwrandType:
+			if g.rnd.Intn(100) < access.readPercent {
+				ad.op = ReadBaseType
+			} else {
+				ad.op = WriteBaseType
+			}
 
-			case NoneType:
-				ad.op = NoneType
+		case RwrandVerifyType:
+			if g.rnd.Intn(100) < access.readPercent {
+				ad.op = ReadBaseVerifyType
+			} else {
+				ad.op = WriteBaseVerifyType
 			}
-			break
-		} else {
-			section -= access.sectionPercent
+
+		case NoneType:
+			ad.op = NoneType
 		}
+		break
 	}
 	return ad
 }
 
-func (j *Job) fileFill(tracker *tracking) {
+// seqBlk moves the shared position of a sequential section past the next I/O.
+func (j *Job) seqBlk(idx int, size int64) int64 {
+	access := &j.sections[idx]
+	end := access.sectionStart + access.weight
+	for {
+		old := atomic.LoadInt64(&j.cursors[idx])
+		cursor := old
+		blk := access.nextSeq(&cursor, access.sectionStart, end, size)
+		if atomic.CompareAndSwapInt64(&j.cursors[idx], old, cursor) {
+			return blk
+		}
+	}
+}
+
+// streamBlk returns the next offset in the worker's own part of the section.
+func (g *accessGen) streamBlk(idx int, size int64) int64 {
+	access := &g.j.sections[idx]
+	start, end := access.workerRegion(g.workId, g.j.JobParams.IODepth)
+	cursor, ok := g.streams[idx]
+	if !ok {
+		cursor = start
+		if access.reverse {
+			cursor = end
+		}
+	}
+	blk := access.nextSeq(&cursor, start, end, size)
+	g.streams[idx] = cursor
+	return blk
+}
+
+// fileFill writes the marker pattern over the whole target. Returns an error if
+// AbortPrep() was called or a write failed.
+func (j *Job) fileFill(tracker *tracking) error {
 	j.JobParams.Force_Fill = true
-	fillJobs := j.JobParams.IODepth
+	workers := j.JobParams.IODepth
+	fillJobs := workers
 	lastBlock := j.JobParams.fileSize
 	fillSize := int64(1024 * 1024)
-	buf := make([]byte, fillSize)
-	j.patternFill(buf)
-	j.threadRun = true
+	ctx := j.begin(JobPrepared)
+	defer j.end(JobPrepared)
 
 	// Make sure when filling the file for the first time to use unique data
 	// in every block. This will prevent file systems like ZFS from collapsing
@@ -364,10 +793,7 @@ func (j *Job) fileFill(tracker *tracking) {
 	go func() {
 		var curBlock int64
 		for curBlock = int64(0); (curBlock + fillSize) <= lastBlock; curBlock += fillSize {
-			if !j.threadRun {
-				for i := 0; i < j.JobParams.IODepth; i++ {
-					j.thrCompletes <- JobReport{}
-				}
+			if ctx.Err() != nil {
 				break
 			}
 			ad := AccessData{op: WriteBaseVerifyType, blk: curBlock, len: int64(1024 * 1024)}
@@ -378,30 +804,53 @@ func (j *Job) fileFill(tracker *tracking) {
 		// at the end which doesn't get initialized, but during the actual run the worker
 		// will access the data. So, create a final write request that accounts for that
 		// last little bit.
-		if j.threadRun && (lastBlock - curBlock) > 0 {
+		if ctx.Err() == nil && (lastBlock - curBlock) > 0 {
 			ad := AccessData{op: WriteBaseVerifyType, blk: curBlock, len: lastBlock - curBlock}
 			j.nextBlks <- ad
 		}
 
-		for i := 0; i < fillJobs; i++ {
+		for i := 0; i < workers; i++ {
 			ad := AccessData{op: StopType}
 			j.nextBlks <- ad
 		}
 
 	}()
 
-	for i := 0; i < fillJobs; i++ {
-		go j.ioWorker(i)
+	// The fill's writes are watched the same as the run's. Workers given up
+	// on are counted as finished.
+	exited := make([]bool, workers)
+	var watchTick <-chan time.Time
+	j.slots = nil
+	if j.JobParams.ioTimeout > 0 {
+		j.slots = make([]ioSlot, workers)
+		watch := time.NewTicker(j.watchInterval())
+		defer watch.Stop()
+		watchTick = watch.C
 	}
 
-	ticker := time.Tick(time.Second)
+	for i := 0; i < workers; i++ {
+		go j.ioWorker(i, func() AccessData { return <-j.nextBlks })
+	}
+	finished := func() error {
+		switch j.reason() {
+		case StopNone:
+			return nil
+		case StopAborted:
+			return fmt.Errorf("forced abort of prep")
+		default:
+			return fmt.Errorf("fill stopped by %s", j.reason())
+		}
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	startTime := time.Now()
 	lastReportedSize := int64(0)
 	fakeETA := int64(0)
 
 	for {
 		select {
-		case <-ticker:
+		case <-ticker.C:
 			fi, _ := j.fp.Stat()
 			elapsed := time.Since(startTime)
 			etaStr := ""
@@ -440,11 +889,25 @@ func (j *Job) fileFill(tracker *tracking) {
 			tracker.UpdateName(j.TargetName, fmt.Sprintf(":%.1f%s",
 				float64(fi.Size())/float64(j.JobParams.fileSize)*100.0, etaStr))
 
-		case <-j.thrCompletes:
+		case rpt := <-j.thrCompletes:
+			if exited[rpt.JobID] {
+				break
+			}
+			exited[rpt.JobID] = true
 			fillJobs--
 			if fillJobs == 0 {
-				j.threadRun = false
-				return
+				return finished()
+			}
+
+		case <-watchTick:
+			for _, w := range j.watchdog(time.Now()) {
+				if !exited[w] {
+					exited[w] = true
+					fillJobs--
+				}
+			}
+			if fillJobs == 0 {
+				return finished()
 			}
 		}
 	}
@@ -466,18 +929,19 @@ func opToString(op int) string {
 		return "WriteVerify"
 	case NoneType:
 		return "None"
+	case SyncType:
+		return "Sync"
 	default:
 		return "Unknown"
 	}
 }
 
 func (j *Job) Stop() {
-	j.threadRun = false
+	j.halt(StopAborted)
 }
 
 func (j *Job) AbortPrep() {
-	j.lastErr = fmt.Errorf("forced abort of prep")
-	j.threadRun = false
+	j.halt(StopAborted)
 }
 
 const (
@@ -537,31 +1001,42 @@ func (j *Job) initBuf(buf []byte, blockNum int64) {
 	}
 }
 
-func (j *Job) ioWorker(workId int) {
+// ioWorker issues each I/O returned by next until it gets a StopType request.
+// Nothing is allocated per I/O. Reads and verify writes use a buffer from the
+// job's pool, other writes take their data from the worker's pattern stream
+// which moves on to new data every reset-buf writes.
+func (j *Job) ioWorker(workId int, next func() AccessData) {
 	var statType int
 	var buf []byte
 
-	lastSizeUsed := int64(0)
 	resetBufCount := 0
 	rpt := JobReport{JobID: workId, ReadErrors: 0, WriteErrors: 0, ReadIOs: 0, WriteIOs: 0}
 	opCnt := 0
+	shard := j.jobStat.shards[workId]
+	var slot *ioSlot
+	if j.slots != nil {
+		slot = &j.slots[workId]
+	}
+	syncAD := AccessData{op: SyncType}
+	bufs := workerBufs{pool: &j.bufs}
+	defer bufs.release()
+	var pattern *patternStream
 	for {
-		ad := <-j.nextBlks
-		if ad.len != lastSizeUsed {
-			lastSizeUsed = ad.len
-			buf = make([]byte, lastSizeUsed)
-			j.patternFill(buf)
-		}
+		ad := next()
 		ioStart := time.Now()
 		switch ad.op {
 		case ReadBaseType, ReadBaseVerifyType:
 			statType = StatRead
 			rpt.ReadIOs++
-			if _, err := j.fp.ReadAt(buf, ad.blk); err != nil {
+			buf = bufs.get(ad.len)
+			slot.issue(&ad, ioStart)
+			_, err := j.target.ReadAt(buf, ad.blk)
+			slot.done()
+			if err != nil {
 				rpt.ReadErrors++
 				if j.bailOnError {
 					fmt.Printf("ReadAt error(0x%x:0x%x) : %s\n", ad.blk, ad.len, err)
-					j.threadRun = false
+					j.halt(StopError)
 					break
 				} else {
 					continue
@@ -569,25 +1044,31 @@ func (j *Job) ioWorker(workId int) {
 			}
 			if ad.op == ReadBaseVerifyType {
 				if !j.validateBuf(buf, ad.blk) {
-					j.threadRun = false
+					rpt.ReadErrors++
+					j.halt(StopError)
 				}
 			}
 		case WriteBaseType, WriteBaseVerifyType:
 			statType = StatWrite
 			rpt.WriteIOs++
 			if ad.op == WriteBaseVerifyType {
+				buf = bufs.get(ad.len)
 				j.initBuf(buf, ad.blk)
 			} else {
-				if (resetBufCount % j.JobParams.Reset_Buf) == 0 {
-					j.patternFill(buf)
+				if pattern == nil {
+					pattern = j.newPatternStream()
 				}
+				buf = pattern.get(ad.len, resetBufCount%j.JobParams.Reset_Buf == 0)
 				resetBufCount += 1
 			}
-			if _, err := j.fp.WriteAt(buf, ad.blk); err != nil {
+			slot.issue(&ad, ioStart)
+			_, err := j.target.WriteAt(buf, ad.blk)
+			slot.done()
+			if err != nil {
 				rpt.WriteErrors++
 				if j.bailOnError {
 					fmt.Printf("WriteAt error(0x%x:0x%x)\n  : %s\n", ad.blk, ad.len, err)
-					j.threadRun = false
+					j.halt(StopError)
 					break
 				} else {
 					continue
@@ -600,11 +1081,23 @@ func (j *Job) ioWorker(workId int) {
 			return
 		}
 		ioDuration := time.Now().Sub(ioStart)
+		opCnt++
 		if (j.JobParams.Fsync != 0) && (opCnt >= j.JobParams.Fsync) {
 			opCnt = 0
-			_ = j.fp.Sync()
+			slot.issue(&syncAD, time.Now())
+			_ = j.target.Sync()
+			slot.done()
+		}
+		if atomic.LoadInt32(&j.ramping) != 0 {
+			continue
+		}
+		if j.JobParams.Verbose {
+			// The heat map needs the offset of every I/O which only
+			// the stats thread can track.
+			j.Stats.Send(StatsRecord{opSize: ad.len, OpType: statType, opDuration: ioDuration,
+				opBlk: ad.blk, opIdx: j.statIdx, job: j.jobStat, section: ad.section})
+		} else {
+			shard.record(statType, ad.len, ioDuration, ad.section)
 		}
-		j.Stats.Send(StatsRecord{opSize: ad.len, OpType: statType, opDuration: ioDuration,
-			opBlk: ad.blk, opIdx: j.statIdx})
 	}
 }
@@ -0,0 +1,294 @@
+package support
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testJob sets up a job against a file in a fresh temporary directory. Run the
+// tests with -race, the point is that stopping can't race with the workers.
+func testJob(t *testing.T, extra string) (*Job, *StatsState) {
+	dir, err := ioutil.TempDir("", "fiod-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cfg, err := readTestConfig(t, fmt.Sprintf(`
+[global]
+version=1
+record-time=1h
+iodepth=4
+[job "life"]
+name=%s
+size=1m
+access-pattern=50:rw:4k,50:randread:8k
+%s
+`, filepath.Join(dir, "target"), extra))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := StatsInit(&cfg.Global, PrintInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stats.Send(StatsRecord{OpType: StatStop}) })
+	j, err := JobInit("life", cfg.Job["life"], stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(j.Fini)
+	if s := j.State(); s != JobPrepared {
+		t.Fatalf("new job is %s", s)
+	}
+	return j, stats
+}
+
+func TestJobLifecycle(t *testing.T) {
+	j, stats := testJob(t, "runtime=1m")
+	if err := j.FillAsNeeded(TrackingInit(PrintInit())); err != nil {
+		t.Fatal(err)
+	}
+	stats.StartJobs([]*Job{j})
+
+	halted := make(chan struct{})
+	go func() {
+		defer close(halted)
+		for j.State() != JobRunning {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		j.Stop()
+		j.Stop()
+	}()
+	if reason := j.Start(); reason != StopAborted {
+		t.Errorf("stopped job ended by %s", reason)
+	}
+	<-halted
+	if s := j.State(); s != JobDone {
+		t.Errorf("finished job is %s", s)
+	}
+	stats.Flush()
+	if n := j.jobStat.total.readIOs + j.jobStat.total.writeIOs; n == 0 {
+		t.Error("no I/O's were counted before the stop")
+	}
+}
+
+func TestJobStopBeforeStart(t *testing.T) {
+	j, _ := testJob(t, "number-ios=100000")
+	if err := j.FillAsNeeded(TrackingInit(PrintInit())); err != nil {
+		t.Fatal(err)
+	}
+	j.Stop()
+	if reason := j.Start(); reason != StopAborted {
+		t.Errorf("job stopped before starting ended by %s", reason)
+	}
+}
+
+func TestJobAbortPrep(t *testing.T) {
+	j, _ := testJob(t, "runtime=1m")
+	j.AbortPrep()
+	if err := j.FillAsNeeded(TrackingInit(PrintInit())); err == nil {
+		t.Error("fill ran to completion after AbortPrep")
+	}
+}
+
+func TestLoopsPerSection(t *testing.T) {
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+record-time=1h
+iodepth=4
+[job "loops"]
+name=null
+size=32m
+loops=2
+access-pattern=50:write:64k,50:randread:4k
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := StatsInit(&cfg.Global, PrintInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Send(StatsRecord{OpType: StatStop})
+	j, err := JobInit("loops", cfg.Job["loops"], stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := j.Start(); reason != StopLoops {
+		t.Fatalf("ended by %s", reason)
+	}
+
+	// The 64k section gets done far sooner but stops at its two passes,
+	// give or take an I/O from each worker.
+	for i, blk := range []int64{64 * 1024, 4096} {
+		want := 2 * j.sections[i].weight
+		if done := j.sectionBytes[i]; done < want || done > want+4*blk {
+			t.Errorf("section %d did %d bytes, want %d", i, done, want)
+		}
+	}
+}
+
+// benchmarkNull runs b.N I/O's against the null target so that only the cost
+// of generating, issuing, and accounting for each I/O is measured. With channel
+// set the requests come from genAccessDataBefore over a channel, the way every
+// job worked before each worker made its own.
+func benchmarkNull(b *testing.B, pattern string, channel bool) {
+	cfg, err := readTestConfig(b, fmt.Sprintf(`
+[global]
+version=1
+record-time=1h
+iodepth=8
+[job "bench"]
+name=null
+size=1g
+number-ios=%d
+access-pattern=%s
+`, b.N, pattern))
+	if err != nil {
+		b.Fatal(err)
+	}
+	stats, err := StatsInit(&cfg.Global, PrintInit())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer stats.Send(StatsRecord{OpType: StatStop})
+	j, err := JobInit("bench", cfg.Job["bench"], stats)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	source := func(workId int) func() AccessData {
+		return j.newAccessGen(workId).next
+	}
+	if channel {
+		var once sync.Once
+		feed := make(chan AccessData, 1000)
+		source = func(workId int) func() AccessData {
+			once.Do(func() { go genAccessDataBefore(j, feed) })
+			return func() AccessData { return <-feed }
+		}
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+	if reason := j.run(source); reason != StopNumberIOs {
+		b.Fatalf("job ended by %s", reason)
+	}
+	stats.Flush()
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "iops")
+}
+
+// lockedSource is the source behind math/rand's global functions as it was
+// when each job had a single generator. Since Go 1.20 the global functions
+// skip the lock unless rand.Seed has been called, so it's made explicit here.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// genAccessDataBefore is the generator every job used before each worker had
+// its own, kept so the benchmarks can compare against it. A single thread walks
+// the access pattern list, copying each section out of the list and back again,
+// draws from the locked global source and hands each request to the workers
+// over a channel. seq-per-worker and random-map came later and aren't handled.
+func genAccessDataBefore(j *Job, feed chan<- AccessData) {
+	rnd := rand.New(&lockedSource{src: rand.NewSource(1)})
+	var ios, bytes int64
+	for {
+		ad := AccessData{}
+		section := rnd.Int63n(j.JobParams.accessWeight)
+		idx := 0
+		for e := j.JobParams.accessPattern.Front(); e != nil; e = e.Next() {
+			access := e.Value.(AccessPattern)
+			if access.weight <= section {
+				section -= access.weight
+				idx++
+				continue
+			}
+			ad.len = access.nextBlkSize(rnd)
+			ad.section = idx
+			switch access.opType {
+			case ReadSeqType, WriteSeqType, RwseqType, ReadSeqVerifyType:
+				ad.blk = access.nextSeq(&access.lastBlk, access.sectionStart,
+					access.sectionStart+access.weight, ad.len)
+			case ReadRandType, WriteRandType, RwrandType, RwrandVerifyType:
+				randBlk := rnd.Int63n((access.sectionEnd - access.sectionStart - ad.len) / 512)
+				ad.blk = randBlk*512 + access.sectionStart
+			}
+			e.Value = access
+
+			switch access.opType {
+			case ReadRandType, ReadSeqType:
+				ad.op = ReadBaseType
+			case ReadSeqVerifyType:
+				ad.op = ReadBaseVerifyType
+			case WriteRandType, WriteSeqType:
+				ad.op = WriteBaseType
+			case RwseqType, RwrandType:
+				if rnd.Intn(100) < access.readPercent {
+					ad.op = ReadBaseType
+				} else {
+					ad.op = WriteBaseType
+				}
+			case RwrandVerifyType:
+				if rnd.Intn(100) < access.readPercent {
+					ad.op = ReadBaseVerifyType
+				} else {
+					ad.op = WriteBaseVerifyType
+				}
+			default:
+				ad.op = NoneType
+			}
+			break
+		}
+		if ad.op != NoneType {
+			if reason := j.JobParams.limitReached(ios, bytes); reason != StopNone {
+				j.halt(reason)
+				break
+			}
+			ios++
+			bytes += ad.len
+		}
+		feed <- ad
+	}
+
+	for i := 0; i < j.JobParams.IODepth; i++ {
+		feed <- AccessData{op: StopType}
+	}
+}
+
+func BenchmarkNullRandRead(b *testing.B) {
+	benchmarkNull(b, "100:randread:4k", false)
+}
+
+func BenchmarkNullRandReadChannel(b *testing.B) {
+	benchmarkNull(b, "100:randread:4k", true)
+}
+
+func BenchmarkNullMixed(b *testing.B) {
+	benchmarkNull(b, "40:rw|70:4k,40:write:64k,20:randwrite:4k-16k", false)
+}
+
+func BenchmarkNullMixedChannel(b *testing.B) {
+	benchmarkNull(b, "40:rw|70:4k,40:write:64k,20:randwrite:4k-16k", true)
+}
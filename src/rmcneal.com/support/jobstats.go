@@ -0,0 +1,317 @@
+package support
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ioCounters are the totals gathered for a job either over the whole run or
+// for a single log interval.
+type ioCounters struct {
+	readIOs  int64
+	writeIOs int64
+	readBW   int64
+	writeBW  int64
+	readLat  time.Duration
+	writeLat time.Duration
+	latency  *DistroGraph
+}
+
+// jobStats holds the counters for a single job. It's created by the job, but
+// once handed to the stats engine with StatAddJob only the StatsWorker thread
+// updates it.
+type jobStats struct {
+	name      string
+	params    *JobData
+	halt      func()
+	startTime time.Time
+	endTime   time.Time
+
+	// Process and system CPU usage when the run phase started and ended.
+	cpuStart cpuSample
+	cpuEnd   cpuSample
+
+	// Block layer counters for the target's device, nil when there's none.
+	disk *diskSampler
+
+	// Which termination condition ended the job and the number of I/O's
+	// which failed, set by StatJobDone.
+	stopReason string
+	errors     int64
+
+	// Set by the StatClear which starts the job. Until then it may be
+	// filling its target and none of its I/O is counted or sampled.
+	started bool
+
+	// Set while the job is in a group waiting on a ramp, its I/O is only
+	// added to its own counters.
+	ramping bool
+
+	total    ioCounters
+	interval ioCounters
+
+	// One for each access pattern section.
+	sections []ioCounters
+
+	// One for each worker, merged into the counters by the stats thread.
+	shards []*statShard
+
+	// The job's I/O buffers, only looked at for the allocation count.
+	bufs *bufPool
+
+	// Values from the previous record-time tick so that each sample is
+	// just the activity during that interval.
+	lastIOs int64
+	lastBW  int64
+
+	// What was done during each record-time interval, for the charts in the
+	// HTML report.
+	intervals []IntervalSample
+
+	// Per interval CSV log. lastLog is when the previous line was written.
+	logw    io.Writer
+	lastLog time.Time
+
+	steady *steadyState
+}
+
+// steadyState watches a sliding window of IOPS or bandwidth samples looking for
+// the point where the job has settled down.
+type steadyState struct {
+	metric  int
+	slope   bool
+	limit   float64
+	samples []float64
+	reached bool
+	elapsed time.Duration
+}
+
+func newJobStats(name string, jd *JobData, halt func(), logw io.Writer) *jobStats {
+	js := &jobStats{name: name, params: jd, halt: halt, logw: logw}
+	js.total.latency = DistroInit(nil, "")
+	js.interval.latency = DistroInit(nil, "")
+	if jd.accessPattern != nil {
+		js.sections = make([]ioCounters, jd.accessPattern.Len())
+		for i := range js.sections {
+			js.sections[i].latency = DistroInit(nil, "")
+		}
+	}
+	if jd.ssMetric != 0 {
+		js.steady = &steadyState{metric: jd.ssMetric, slope: jd.ssSlope, limit: jd.ssLimit}
+	}
+	if logw != nil {
+		_, _ = fmt.Fprintln(logw, "# Time, Read IOPS, Write IOPS, Read B/W, Write B/W, Read Lat Avg(ns), "+
+			"Write Lat Avg(ns), P50(ns), P90(ns), P99(ns), P99.9(ns), Depth")
+	}
+	js.clear()
+	return js
+}
+
+func (c *ioCounters) clear() {
+	c.readIOs, c.writeIOs, c.readBW, c.writeBW = 0, 0, 0, 0
+	c.readLat, c.writeLat = 0, 0
+	c.latency.Clear()
+}
+
+func (c *ioCounters) record(r *StatsRecord) {
+	switch r.OpType {
+	case StatRead:
+		c.readIOs++
+		c.readBW += r.opSize
+		c.readLat += r.opDuration
+	case StatWrite:
+		c.writeIOs++
+		c.writeBW += r.opSize
+		c.writeLat += r.opDuration
+	}
+	c.latency.Aggregate(r.opDuration)
+}
+
+func (c *ioCounters) readAvg() time.Duration {
+	if c.readIOs == 0 {
+		return 0
+	}
+	return c.readLat / time.Duration(c.readIOs)
+}
+
+func (c *ioCounters) writeAvg() time.Duration {
+	if c.writeIOs == 0 {
+		return 0
+	}
+	return c.writeLat / time.Duration(c.writeIOs)
+}
+
+func (js *jobStats) clear() {
+	js.startTime = time.Now()
+	js.endTime = time.Time{}
+	js.cpuStart, js.cpuEnd = takeCPUSample(), cpuSample{}
+	if js.disk != nil {
+		js.disk.reset(js.startTime)
+	}
+	js.stopReason = ""
+	js.errors = 0
+	js.lastLog = js.startTime
+	js.total.clear()
+	js.interval.clear()
+	for i := range js.sections {
+		js.sections[i].clear()
+	}
+	for _, sh := range js.shards {
+		sh.reset()
+	}
+	js.lastIOs, js.lastBW = 0, 0
+	js.intervals = nil
+	if js.steady != nil {
+		js.steady.samples = nil
+		js.steady.reached = false
+		js.steady.elapsed = 0
+	}
+}
+
+func (js *jobStats) record(r *StatsRecord) {
+	js.total.record(r)
+	js.interval.record(r)
+	if r.section >= 0 && r.section < len(js.sections) {
+		js.sections[r.section].record(r)
+	}
+}
+
+// logInterval writes one line to the job's CSV log covering the activity since
+// the last line and then starts a new interval.
+func (js *jobStats) logInterval(now time.Time) {
+	elapsed := now.Sub(js.lastLog)
+	if js.logw == nil || elapsed <= 0 {
+		return
+	}
+	c := &js.interval
+	secs := elapsed.Seconds()
+
+	// The average number of I/O's in flight over the interval is the
+	// total time spent waiting on I/O divided by the length of the
+	// interval (Little's law).
+	depth := float64(c.readLat+c.writeLat) / float64(elapsed)
+
+	_, _ = fmt.Fprintf(js.logw, "%.3f, %.0f, %.0f, %.0f, %.0f, %d, %d, %d, %d, %d, %d, %.2f\n",
+		now.Sub(js.startTime).Seconds(),
+		float64(c.readIOs)/secs, float64(c.writeIOs)/secs,
+		float64(c.readBW)/secs, float64(c.writeBW)/secs,
+		c.readAvg(), c.writeAvg(),
+		c.latency.Percentile(50), c.latency.Percentile(90),
+		c.latency.Percentile(99), c.latency.Percentile(99.9), depth)
+	js.lastLog = now
+	c.clear()
+}
+
+// String is the one line summary used for intermediate stats.
+func (js *jobStats) String() string {
+	c := &js.total
+	secs := time.Since(js.startTime).Seconds()
+	if secs < 1 {
+		secs = 1
+	}
+	return fmt.Sprintf("[%s] IOPS: %s, BW: %s, Lat(r:%s,w:%s), P99: %s", js.name,
+		Humanize(int64(float64(c.readIOs+c.writeIOs)/secs), 1),
+		Humanize(int64(float64(c.readBW+c.writeBW)/secs), 1),
+		c.readAvg(), c.writeAvg(), c.latency.Percentile(99))
+}
+
+// sample is called every record-time tick. If the job has reached steady state
+// it's told to stop. Nothing is done before the job has started.
+func (js *jobStats) sample(interval time.Duration) {
+	if !js.started {
+		return
+	}
+	ios := js.total.readIOs + js.total.writeIOs
+	bw := js.total.readBW + js.total.writeBW
+	iosDelta, bwDelta := ios-js.lastIOs, bw-js.lastBW
+	js.lastIOs, js.lastBW = ios, bw
+	if secs := interval.Seconds(); secs > 0 && js.endTime.IsZero() {
+		js.intervals = append(js.intervals, IntervalSample{Elapsed: time.Since(js.startTime),
+			IOPS: int64(float64(iosDelta) / secs), BW: int64(float64(bwDelta) / secs)})
+	}
+	if js.disk != nil {
+		js.disk.tick(time.Now())
+	}
+
+	ss := js.steady
+	if ss == nil || ss.reached {
+		return
+	}
+	val := float64(iosDelta)
+	if ss.metric == SteadyBWType {
+		val = float64(bwDelta)
+	}
+	ss.samples = append(ss.samples, val/interval.Seconds())
+	if len(ss.samples) > js.params.Steady_State_Window {
+		ss.samples = ss.samples[1:]
+	}
+	if len(ss.samples) == js.params.Steady_State_Window && ss.deviation() <= ss.limit {
+		ss.reached = true
+		ss.elapsed = time.Since(js.startTime)
+		if js.halt != nil {
+			js.halt()
+		}
+	}
+}
+
+// deviation returns, as a percentage of the window average, either the
+// difference between the largest and smallest samples or the excursion of
+// the least squares line across the window.
+func (ss *steadyState) deviation() float64 {
+	n := float64(len(ss.samples))
+	sum, low, high := 0.0, math.MaxFloat64, 0.0
+	for _, v := range ss.samples {
+		sum += v
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	avg := sum / n
+	if avg == 0 {
+		return math.MaxFloat64
+	}
+	if !ss.slope {
+		return (high - low) / avg * 100.0
+	}
+
+	var sumX, sumXY, sumXX float64
+	for x, y := range ss.samples {
+		sumX += float64(x)
+		sumXY += float64(x) * y
+		sumXX += float64(x) * float64(x)
+	}
+	slope := (n*sumXY - sumX*sum) / (n*sumXX - sumX*sumX)
+	return math.Abs(slope) * (n - 1) / avg * 100.0
+}
+
+func (ss *steadyState) name() string {
+	name := SteadyIOPS
+	if ss.metric == SteadyBWType {
+		name = SteadyBW
+	}
+	if ss.slope {
+		name += "-slope"
+	}
+	return name
+}
+
+func (ss *steadyState) String() string {
+	var buffer bytes.Buffer
+
+	name := ss.name()
+	if ss.reached {
+		_, _ = fmt.Fprintf(&buffer, "reached after %s", ss.elapsed.Truncate(time.Second))
+	} else {
+		_, _ = fmt.Fprintf(&buffer, "not reached before runtime")
+	}
+	if dev := ss.deviation(); len(ss.samples) > 0 && dev != math.MaxFloat64 {
+		_, _ = fmt.Fprintf(&buffer, ", %s %.1f%% (limit %.1f%%), window:", name, dev, ss.limit)
+		for _, v := range ss.samples {
+			_, _ = fmt.Fprintf(&buffer, " %s", strings.TrimSpace(Humanize(int64(v), 1)))
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,134 @@
+package support
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSectionStats(t *testing.T) {
+	jd := &JobData{Access_Pattern: "50:randread:4k,30:write:8k", fileSize: 100 * 1024 * 1024}
+	if err := jd.parseAccessPattern(); err != nil {
+		t.Fatal(err)
+	}
+	if err := jd.layoutSections(); err != nil {
+		t.Fatal(err)
+	}
+	js := newJobStats("test", jd, nil, nil)
+	for i := 0; i < 3; i++ {
+		js.record(&StatsRecord{OpType: StatRead, opSize: 4096, opDuration: time.Millisecond, section: 0})
+	}
+	js.record(&StatsRecord{OpType: StatWrite, opSize: 8192, opDuration: 2 * time.Millisecond, section: 1})
+
+	sections := js.sectionResults(time.Second)
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, wanted 2 (the idle section is skipped)", len(sections))
+	}
+	if s := sections[0]; s.ReadIOs != 3 || s.WriteIOs != 0 || s.IOPS != 3 || s.ReadLatAvg != time.Millisecond {
+		t.Errorf("section 0: %+v", s)
+	}
+	if s := sections[1]; s.WriteIOs != 1 || s.WriteBytes != 8192 || s.Start != 50*1024*1024 {
+		t.Errorf("section 1: %+v", s)
+	}
+	if js.total.readIOs+js.total.writeIOs != 4 {
+		t.Errorf("job totals don't include every section")
+	}
+}
+
+func TestSteadyStateDeviation(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		rng     float64
+		slope   float64
+	}{
+		{"flat", []float64{100, 100, 100}, 0, 0},
+		{"ramping", []float64{100, 200, 300}, 100, 100},
+		{"noisy", []float64{100, 300, 100, 300, 100}, 200.0 / 180.0 * 100.0, 0},
+		{"idle", []float64{0, 0, 0}, math.MaxFloat64, math.MaxFloat64},
+	}
+	for _, tc := range tests {
+		for _, slope := range []bool{false, true} {
+			ss := &steadyState{slope: slope, samples: tc.samples}
+			want := tc.rng
+			if slope {
+				want = tc.slope
+			}
+			if got := ss.deviation(); math.Abs(got-want) > 1e-9 {
+				t.Errorf("%s slope %v: deviation %f, want %f", tc.name, slope, got, want)
+			}
+		}
+	}
+}
+
+func TestSteadyStateSample(t *testing.T) {
+	jd := &JobData{ssMetric: SteadyIOPSType, ssLimit: 10, Steady_State_Window: 3}
+	halts := 0
+	js := newJobStats("test", jd, func() { halts++ }, nil)
+
+	// I/O from filling the target, before the job is started, isn't sampled.
+	js.total.writeIOs = 5000
+	js.sample(time.Second)
+	if len(js.intervals) != 0 || len(js.steady.samples) != 0 {
+		t.Fatalf("sampled before the start: %d intervals, %d samples", len(js.intervals), len(js.steady.samples))
+	}
+
+	js.clear()
+	js.started = true
+	for i, n := range []int64{100, 200, 300, 300, 300} {
+		js.total.readIOs += n
+		js.sample(time.Second)
+		// Only the last window, three samples of 300, is within 10%.
+		reached := i == 4
+		if js.steady.reached != reached || (halts == 1) != reached {
+			t.Errorf("sample %d of %d I/O's: reached %v, %d halts", i, n, js.steady.reached, halts)
+		}
+	}
+	if len(js.intervals) != 5 || js.intervals[1].IOPS != 200 {
+		t.Errorf("intervals %+v", js.intervals)
+	}
+}
+
+func TestLogInterval(t *testing.T) {
+	var log bytes.Buffer
+	js := newJobStats("test", &JobData{}, nil, &log)
+	header := strings.Split(log.String(), "\n")[0]
+	if cols := strings.Split(header, ","); len(cols) != 12 || !strings.HasPrefix(header, "# Time") {
+		t.Fatalf("header %q", header)
+	}
+	log.Reset()
+
+	// 200ms spent on reads and 300ms on writes over one second is an
+	// average of half an I/O in flight.
+	for i := 0; i < 10; i++ {
+		js.record(&StatsRecord{OpType: StatRead, opSize: 4096, opDuration: 20 * time.Millisecond})
+	}
+	for i := 0; i < 5; i++ {
+		js.record(&StatsRecord{OpType: StatWrite, opSize: 8192, opDuration: 60 * time.Millisecond})
+	}
+	c := &js.interval
+	pct := fmt.Sprintf("%d, %d, %d, %d", c.latency.Percentile(50), c.latency.Percentile(90),
+		c.latency.Percentile(99), c.latency.Percentile(99.9))
+	js.logInterval(js.startTime.Add(time.Second))
+	want := "1.000, 10, 5, 40960, 40960, 20000000, 60000000, " + pct + ", 0.50\n"
+	if log.String() != want {
+		t.Errorf("got  %q\nwant %q", log.String(), want)
+	}
+
+	// The next line only covers what's happened since and a second line
+	// for the same moment isn't written.
+	if c.readIOs != 0 || c.latency.Count() != 0 || js.total.readIOs != 10 {
+		t.Errorf("interval wasn't started again")
+	}
+	log.Reset()
+	js.logInterval(js.startTime.Add(time.Second))
+	js.record(&StatsRecord{OpType: StatRead, opSize: 4096, opDuration: time.Millisecond})
+	js.record(&StatsRecord{OpType: StatRead, opSize: 4096, opDuration: time.Millisecond})
+	js.logInterval(js.startTime.Add(3 * time.Second))
+	if line := log.String(); !strings.HasPrefix(line, "3.000, 1, 0, 4096, 0, 1000000, 0, ") {
+		t.Errorf("second line %q", line)
+	}
+}
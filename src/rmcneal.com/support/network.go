@@ -2,12 +2,15 @@ package support
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"math/rand"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,12 +52,20 @@ type Task struct {
 	fileSize   int64
 	removeFile bool
 	params     map[string]string
-	state      int
-	stateChans chan int
-	iopsRd     int64
-	iopsWr     int64
-	xferRd     int64
-	xferWr     int64
+
+	// state is only changed with atomic operations since the stop, clear
+	// and show commands look at it while the runner is going.
+	state int32
+
+	// cancel stops the runner, which closes done once the file is cleaned up.
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	iopsRd int64
+	iopsWr int64
+	xferRd int64
+	xferWr int64
 }
 
 type CommandEngine struct {
@@ -100,6 +111,7 @@ func (ce *CommandEngine) control() {
 		if line, err := ce.incoming.ReadString('\n'); err != nil {
 			fmt.Printf("ReadString error=%s\n", err)
 			cmdStop(ce, strings.Split("stop", " "))
+			return
 		} else {
 			args := strings.Split(strings.TrimSpace(line), " ")
 			ce.runCmd(args)
@@ -154,7 +166,7 @@ func cmdTask(ce *CommandEngine, args []string) {
 		readPerStr: "50",
 		accessStr:  accessRandStr,
 		runTimeStr: "0",
-	}, state: IDLE, stateChans: make(chan int), removeFile: false}
+	}, state: IDLE, removeFile: false}
 	ce.taskLists = append(ce.taskLists, t)
 	ce.curTask = t
 }
@@ -175,7 +187,7 @@ func cmdShow(ce *CommandEngine, args []string) {
 		for k, v := range t.params {
 			fmt.Fprintf(ce.conn, "    %s: %s\n", k, v)
 		}
-		fmt.Fprintf(ce.conn, "    state: %s\n", stateToStr(t.state))
+		fmt.Fprintf(ce.conn, "    state: %s\n", stateToStr(t.getState()))
 	}
 }
 
@@ -187,15 +199,12 @@ func cmdStart(ce *CommandEngine, args []string) {
 }
 
 func cmdStopOne(t *Task) {
-	// Only in the run state will the task be looking at the channel
-	if t.getState() == RUN {
-		t.stateChans <- CLEANUP
-		for {
-			if t.getState() == FINISHED {
-				break
-			}
-			time.Sleep(time.Second)
-		}
+	t.mu.Lock()
+	cancel, done := t.cancel, t.done
+	t.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
 	}
 	// Reset here instead of just after the FINISHED state is detected because
 	// the thread may have already finished. The stop command can then be used
@@ -229,31 +238,59 @@ func cmdStats(ce *CommandEngine, args []string) {
 	for _, tVal := range ce.taskLists {
 		if len(args) == 1 || strings.Compare(args[1], tVal.name) == 0 {
 			fmt.Fprintf(ce.conn, "%s: iops_rw: %d, iopsWr: %d, xferRd: %d, xferWr: %d\n", tVal.name,
-				tVal.iopsRd, tVal.iopsWr, tVal.xferRd, tVal.xferWr)
+				atomic.LoadInt64(&tVal.iopsRd), atomic.LoadInt64(&tVal.iopsWr),
+				atomic.LoadInt64(&tVal.xferRd), atomic.LoadInt64(&tVal.xferWr))
 		}
 	}
 }
 func (t *Task) getState() int {
-	return t.state
+	return int(atomic.LoadInt32(&t.state))
+}
+
+func (t *Task) setState(state int) {
+	atomic.StoreInt32(&t.state, int32(state))
 }
 
+// resetState clears the counters. A task which has finished can be started
+// again, one that's still running is left alone.
 func (t *Task) resetState() {
-	t.state = IDLE
-	t.iopsRd = 0
-	t.iopsWr = 0
-	t.xferWr = 0
-	t.xferRd = 0
+	atomic.CompareAndSwapInt32(&t.state, FINISHED, IDLE)
+	atomic.StoreInt64(&t.iopsRd, 0)
+	atomic.StoreInt64(&t.iopsWr, 0)
+	atomic.StoreInt64(&t.xferWr, 0)
+	atomic.StoreInt64(&t.xferRd, 0)
 }
 
-func (t *Task) runner(ce *CommandEngine) {
-	ticker := time.Tick(time.Second)
+// begin makes the cancel function and done channel for a run available to
+// cmdStopOne.
+func (t *Task) begin() context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel, t.done = cancel, make(chan struct{})
+	return ctx
+}
+
+func (t *Task) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cancel()
+	close(t.done)
+	t.cancel, t.done = nil, nil
+}
 
-	if t.state != IDLE {
+func (t *Task) runner(ce *CommandEngine) {
+	if !atomic.CompareAndSwapInt32(&t.state, IDLE, PREP) {
 		fmt.Fprintf(ce.conn, "Task [%s] already running\n", t.name)
 		return
 	}
-	t.state = PREP
+	ctx := t.begin()
+	defer t.end()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
 	if t.prepVars(ce) == false {
+		t.setState(FINISHED)
 		return
 	}
 
@@ -262,14 +299,14 @@ func (t *Task) runner(ce *CommandEngine) {
 	// parameter will have been parsed. It all depends on which order the parameters
 	// are found in the dictionary.
 	if t.prepFile(ce) == false {
+		t.setState(FINISHED)
 		return
 	}
-	t.state = RUN
-	for t.state == RUN {
+	t.setState(RUN)
+	for ctx.Err() == nil {
 		select {
-		case state := <-t.stateChans:
-			t.state = state
-		case <-ticker:
+		case <-ctx.Done():
+		case <-ticker.C:
 			break
 		default:
 			var buf []byte
@@ -285,35 +322,35 @@ func (t *Task) runner(ce *CommandEngine) {
 			if strings.Compare(t.params[accessStr], accessSeqStr) == 0 {
 				if rand.Int31n(100) < t.readPer {
 					t.fd.Read(buf)
-					t.iopsRd++
-					t.xferRd += int64(len(buf))
+					atomic.AddInt64(&t.iopsRd, 1)
+					atomic.AddInt64(&t.xferRd, int64(len(buf)))
 				} else {
 					t.fd.Write(buf)
-					t.iopsWr++
-					t.xferWr += int64(len(buf))
+					atomic.AddInt64(&t.iopsWr, 1)
+					atomic.AddInt64(&t.xferWr, int64(len(buf)))
 				}
 			} else {
 				blkNum := rand.Int63n(t.fileSize) >> 9 << 9
 				if rand.Int31n(100) < t.readPer {
 					t.fd.ReadAt(buf, blkNum)
-					t.iopsRd++
-					t.xferRd += int64(len(buf))
+					atomic.AddInt64(&t.iopsRd, 1)
+					atomic.AddInt64(&t.xferRd, int64(len(buf)))
 				} else {
 					t.fd.WriteAt(buf, blkNum)
-					t.iopsWr++
-					t.xferWr += int64(len(buf))
+					atomic.AddInt64(&t.iopsWr, 1)
+					atomic.AddInt64(&t.xferWr, int64(len(buf)))
 				}
 			}
 		}
 	}
-	t.state = CLEANUP
+	t.setState(CLEANUP)
 	t.fd.Close()
 	if t.removeFile {
 		if err := os.Remove(t.params[deviceStr]); err != nil {
 			fmt.Fprintf(ce.conn, "Failed to remove %s, error=%s\n", t.params[deviceStr], err)
 		}
 	}
-	t.state = FINISHED
+	t.setState(FINISHED)
 }
 
 var taskPrepTables = map[string]func(*Task, *CommandEngine, string) bool{
@@ -493,6 +530,8 @@ func stateToStr(s int) string {
 	switch s {
 	case IDLE:
 		return "IDLE"
+	case PREP:
+		return "PREP"
 	case RUN:
 		return "RUN"
 	case CLEANUP:
@@ -45,7 +45,7 @@ func (p *Printer) printWorker() {
 					p.incoming <- op
 				}()
 			} else {
-				fmt.Printf(op.OpStr)
+				fmt.Print(op.OpStr)
 			}
 		case PrintLn:
 			if p.group {
@@ -61,7 +61,7 @@ func (p *Printer) printWorker() {
 		case PrintGroupEnd:
 			p.group = false
 		case PrintGroupStr:
-			fmt.Printf(op.OpStr)
+			fmt.Print(op.OpStr)
 		}
 	}
 }
@@ -0,0 +1,234 @@
+package support
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+/*
+ * The member names must all start with a capital letter else JSON
+ * will not encode the data.
+ */
+type LatencyPercentiles struct {
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	P999 time.Duration
+}
+
+type SteadyStateResult struct {
+	Metric    string
+	Limit     float64
+	Reached   bool
+	Elapsed   time.Duration
+	Deviation float64
+	Window    []float64
+}
+
+// SectionResult is the breakdown for one access pattern section of a job.
+type SectionResult struct {
+	Index       int
+	Op          string
+	BlockSize   string
+	Start       int64
+	End         int64
+	ReadIOs     int64
+	WriteIOs    int64
+	ReadBytes   int64
+	WriteBytes  int64
+	IOPS        int64
+	BW          int64
+	ReadLatAvg  time.Duration
+	WriteLatAvg time.Duration
+	Latency     LatencyPercentiles
+
+	// Passes over the section made by random-map.
+	Passes float64 `json:",omitempty"`
+}
+
+// IntervalSample is the rate of a job during one record-time interval which
+// ended Elapsed into the run.
+type IntervalSample struct {
+	Elapsed time.Duration
+	IOPS    int64
+	BW      int64
+}
+
+// JobResult is the final set of numbers for one job. Rates are per second.
+type JobResult struct {
+	Name        string
+	Label       string `json:",omitempty"`
+	Runtime     time.Duration
+	ReadIOs     int64
+	WriteIOs    int64
+	ReadBytes   int64
+	WriteBytes  int64
+	IOPS        int64
+	BW          int64
+	ReadBW      int64
+	WriteBW     int64
+	ReadLatAvg  time.Duration
+	WriteLatAvg time.Duration
+	Latency     LatencyPercentiles
+	Histogram   []int64
+	SteadyState *SteadyStateResult `json:",omitempty"`
+	Sections    []*SectionResult   `json:",omitempty"`
+	StopReason  string             `json:",omitempty"`
+	Errors      int64
+	CPU         *CPUResult         `json:",omitempty"`
+	Device      *DeviceResult      `json:",omitempty"`
+	Intervals   []IntervalSample   `json:",omitempty"`
+	Assertions  []*AssertionResult `json:",omitempty"`
+}
+
+// Report is what's written by fiod -json.
+type Report struct {
+	Version int
+	JobFile string
+	Created time.Time
+	Jobs    []*JobResult
+}
+
+func (js *jobStats) result() *JobResult {
+	c := &js.total
+	r := &JobResult{Name: js.name, Label: js.params.sweepLabel, Runtime: js.runtime(),
+		ReadIOs: c.readIOs, WriteIOs: c.writeIOs, ReadBytes: c.readBW, WriteBytes: c.writeBW,
+		ReadLatAvg: c.readAvg(), WriteLatAvg: c.writeAvg()}
+	if secs := r.Runtime.Seconds(); secs > 0 {
+		r.IOPS = int64(float64(c.readIOs+c.writeIOs) / secs)
+		r.ReadBW = int64(float64(c.readBW) / secs)
+		r.WriteBW = int64(float64(c.writeBW) / secs)
+		r.BW = r.ReadBW + r.WriteBW
+	}
+	r.Latency = c.percentiles()
+	r.Histogram = append([]int64(nil), c.latency.Bins...)
+	if ss := js.steady; ss != nil {
+		r.SteadyState = &SteadyStateResult{Metric: ss.name(), Limit: ss.limit, Reached: ss.reached,
+			Elapsed: ss.elapsed, Window: append([]float64(nil), ss.samples...)}
+		if len(ss.samples) != 0 {
+			r.SteadyState.Deviation = ss.deviation()
+		}
+	}
+	r.Sections = js.sectionResults(r.Runtime)
+	r.StopReason = js.stopReason
+	r.Errors = js.errors
+	r.CPU = js.cpu()
+	r.Intervals = append([]IntervalSample(nil), js.intervals...)
+	if js.disk != nil {
+		r.Device = js.disk.result()
+	}
+	return r
+}
+
+// cpu is what the process used during the job's run, or so far if it's not
+// done.
+func (js *jobStats) cpu() *CPUResult {
+	end := js.cpuEnd
+	if end.when.IsZero() {
+		end = takeCPUSample()
+	}
+	return cpuSince(js.cpuStart, end, js.total.readIOs+js.total.writeIOs)
+}
+
+// runtime is how long the job ran, or has been running if it's not done.
+func (js *jobStats) runtime() time.Duration {
+	end := js.endTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(js.startTime)
+}
+
+func (c *ioCounters) percentiles() LatencyPercentiles {
+	return LatencyPercentiles{P50: c.latency.Percentile(50), P90: c.latency.Percentile(90),
+		P99: c.latency.Percentile(99), P999: c.latency.Percentile(99.9)}
+}
+
+// sectionResults returns the numbers for each section of the access pattern
+// which does I/O. Nothing is returned when there's only one such section since
+// it would be the same as the job totals, unless random-map is used.
+func (js *jobStats) sectionResults(runtime time.Duration) []*SectionResult {
+	if js.params.accessPattern == nil {
+		return nil
+	}
+	var results []*SectionResult
+	haveMap := false
+	idx := 0
+	for e := js.params.accessPattern.Front(); e != nil; e, idx = e.Next(), idx+1 {
+		access := e.Value.(AccessPattern)
+		if access.opType == NoneType || idx >= len(js.sections) {
+			continue
+		}
+		c := &js.sections[idx]
+		r := &SectionResult{Index: idx, Op: access.opDesc(), BlockSize: access.blkDesc,
+			Start: access.sectionStart, End: access.sectionStart + access.weight,
+			ReadIOs: c.readIOs, WriteIOs: c.writeIOs, ReadBytes: c.readBW, WriteBytes: c.writeBW,
+			ReadLatAvg: c.readAvg(), WriteLatAvg: c.writeAvg(), Latency: c.percentiles()}
+		if secs := runtime.Seconds(); secs > 0 {
+			r.IOPS = int64(float64(c.readIOs+c.writeIOs) / secs)
+			r.BW = int64(float64(c.readBW+c.writeBW) / secs)
+		}
+		if access.randMap != nil {
+			r.Passes = access.randMap.coverage()
+			haveMap = true
+		}
+		results = append(results, r)
+	}
+	if len(results) <= 1 && !haveMap {
+		return nil
+	}
+	return results
+}
+
+// sectionTable formats the per-section breakdown for the summary.
+func sectionTable(sections []*SectionResult) string {
+	titles := []string{"Section", "Op", "Block", "Range", "IOPS", "BW", "Read Lat", "Write Lat", "P99"}
+	haveMap := false
+	for _, r := range sections {
+		haveMap = haveMap || r.Passes != 0
+	}
+	if haveMap {
+		titles = append(titles, "Passes")
+	}
+	var rows [][]string
+	for _, r := range sections {
+		row := []string{fmt.Sprintf("%d", r.Index), r.Op, r.BlockSize,
+			strings.TrimSpace(Humanize(r.Start, 1)) + "-" + strings.TrimSpace(Humanize(r.End, 1)),
+			strings.TrimSpace(Humanize(r.IOPS, 1)), strings.TrimSpace(Humanize(r.BW, 1)),
+			r.ReadLatAvg.String(), r.WriteLatAvg.String(), r.Latency.P99.String()}
+		if haveMap {
+			row = append(row, fmt.Sprintf("%.2f", r.Passes))
+		}
+		rows = append(rows, row)
+	}
+	return FormatTable(titles, rows, 4)
+}
+
+func WriteReport(filename string, report *Report) error {
+	if b, err := json.MarshalIndent(report, "", "  "); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(filename, b, 0666)
+	}
+}
+
+// PrintSweepTable displays one line for each job created by a sweep.
+func PrintSweepTable(results []*JobResult, printer *Printer) {
+	titles := []string{"Job", "Parameters", "IOPS", "BW", "Read Lat", "Write Lat", "P99"}
+	var rows [][]string
+	for _, r := range results {
+		if r.Label == "" {
+			continue
+		}
+		rows = append(rows, []string{r.Name, r.Label, strings.TrimSpace(Humanize(r.IOPS, 1)),
+			strings.TrimSpace(Humanize(r.BW, 1)), r.ReadLatAvg.String(), r.WriteLatAvg.String(),
+			r.Latency.P99.String()})
+	}
+	if len(rows) == 0 {
+		return
+	}
+	printer.Send("\nSweep results\n%s\n", FormatTable(titles, rows, 2))
+}
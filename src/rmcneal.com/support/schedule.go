@@ -0,0 +1,269 @@
+package support
+
+import (
+	"time"
+)
+
+// Where each job is in the schedule, by the name tracked.
+const (
+	schedWaiting = iota + 1
+	schedPreparing
+	schedRunning
+)
+
+// jobBatch are jobs which became ready at the same moment. They're prepared
+// together and started together, the same as the jobs between two barriers.
+type jobBatch struct {
+	names []string
+	jobs  []*Job
+	ready int
+	ok    bool
+}
+
+//
+// Scheduler -- run the jobs of a job file as the jobs they wait for complete
+//
+// Each job starts once every job it waits for is done, with start-after
+// adding a delay. Jobs freed by the same completion form a batch which is
+// prepared and then started at once. While nothing is running the summary
+// of the jobs which ran is displayed and they're cleaned up.
+//
+// Everything other than the waiting, filling and running itself happens on
+// the goroutine which calls Run().
+//
+type Scheduler struct {
+	cfg     *Configs
+	stats   *StatsState
+	printer *Printer
+	track   *tracking
+
+	// Number of jobs each job is still waiting for and the jobs waiting
+	// on it.
+	pending    map[string]int
+	dependents map[string][]string
+
+	jobs    map[string]*Job
+	phase   map[string]int
+	batches map[string]*jobBatch
+
+	// Jobs which ran since the last summary.
+	finished []*Job
+	running  int
+
+	// Once a job can't be prepared nothing else is started.
+	failed bool
+}
+
+func NewScheduler(cfg *Configs, stats *StatsState, printer *Printer) *Scheduler {
+	s := &Scheduler{cfg: cfg, stats: stats, printer: printer, track: TrackingInit(printer),
+		pending: map[string]int{}, dependents: map[string][]string{}, jobs: map[string]*Job{},
+		phase: map[string]int{}, batches: map[string]*jobBatch{}}
+	for _, name := range *cfg.GetJobsList() {
+		for _, dep := range cfg.Job[name].GetWaitFor() {
+			s.pending[name]++
+			s.dependents[dep] = append(s.dependents[dep], name)
+		}
+	}
+	return s
+}
+
+// Run returns once every job which could be run is done. It's false if a job
+// couldn't be set up or its target couldn't be filled.
+func (s *Scheduler) Run() bool {
+	var ready []string
+	for _, name := range *s.cfg.GetJobsList() {
+		if s.pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	s.track.OnComplete(s.complete)
+	s.release(ready)
+	s.track.WaitForThreads()
+	return !s.failed
+}
+
+// release splits jobs whose wait is over into batches by their start-after.
+func (s *Scheduler) release(names []string) {
+	var delays []time.Duration
+	byDelay := map[time.Duration][]string{}
+	for _, name := range names {
+		d := s.cfg.Job[name].GetStartAfter()
+		if _, ok := byDelay[d]; !ok {
+			delays = append(delays, d)
+		}
+		byDelay[d] = append(byDelay[d], name)
+	}
+	for _, d := range delays {
+		b := &jobBatch{names: byDelay[d], ok: true}
+		if d == 0 {
+			s.prepare(b)
+		} else {
+			s.wait(b, d)
+		}
+	}
+}
+
+func (s *Scheduler) wait(b *jobBatch, delay time.Duration) {
+	for _, name := range b.names {
+		s.phase[name] = schedWaiting
+		s.batches[name] = b
+		stop := make(chan struct{})
+		s.track.RunFunc(name, func() bool {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return true
+			case <-stop:
+				return false
+			}
+		}, func() { close(stop) })
+	}
+	s.display()
+}
+
+func (s *Scheduler) prepare(b *jobBatch) {
+	if s.failed {
+		return
+	}
+	b.ready = 0
+	for _, name := range b.names {
+		job, err := JobInit(name, s.cfg.Job[name], s.stats)
+		if err != nil {
+			s.printer.Send("[%s] %s\n", name, err)
+			s.failed = true
+			for _, j := range b.jobs {
+				j.Fini()
+			}
+			return
+		}
+		s.jobs[name] = job
+		b.jobs = append(b.jobs, job)
+		if s.cfg.Global.Verbose {
+			s.printer.Send("---- [%s] ----\n", name)
+			DisplayInterface(s.cfg.Job[name], s.printer)
+		}
+	}
+	for _, job := range b.jobs {
+		job := job
+		s.phase[job.TargetName] = schedPreparing
+		s.batches[job.TargetName] = b
+		s.track.RunFunc(job.TargetName, func() bool {
+			if err := job.FillAsNeeded(s.track); err != nil {
+				s.printer.Send("\nERROR: [%s] %s\n", job.GetName(), err)
+				return false
+			}
+			return true
+		}, func() { job.AbortPrep() })
+	}
+	s.display()
+}
+
+func (s *Scheduler) start(b *jobBatch) {
+	if s.running == 0 {
+		s.track.PrintDone()
+	}
+	s.stats.StartJobs(b.jobs)
+	s.running += len(b.jobs)
+	for _, job := range b.jobs {
+		job := job
+		s.phase[job.TargetName] = schedRunning
+		s.track.RunFunc(job.TargetName, func() bool {
+			job.Start()
+			return true
+		}, func() { job.Stop() })
+	}
+	s.display()
+}
+
+// complete is called by the tracker as each wait, fill or run finishes.
+func (s *Scheduler) complete(name string, okay bool) {
+	b := s.batches[name]
+	switch s.phase[name] {
+	case schedWaiting, schedPreparing:
+		// Waits and fills are only cut short by an error or the user
+		// giving up on the run.
+		if !okay {
+			b.ok = false
+			s.failed = true
+		}
+		b.ready++
+		if b.ready != len(b.names) {
+			return
+		}
+		switch {
+		case !b.ok || s.failed:
+			for _, j := range b.jobs {
+				j.Fini()
+			}
+		case s.phase[name] == schedWaiting:
+			s.prepare(b)
+		default:
+			s.start(b)
+		}
+
+	case schedRunning:
+		delete(s.batches, name)
+		s.finished = append(s.finished, s.jobs[name])
+		s.running--
+		var ready []string
+		for _, dep := range s.dependents[name] {
+			s.pending[dep]--
+			if s.pending[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+		if s.running == 0 {
+			s.summary()
+		}
+		if !s.failed {
+			s.release(ready)
+		}
+	}
+	s.display()
+}
+
+// summary shows the results of the jobs which ran since the last one and
+// cleans up after them.
+func (s *Scheduler) summary() {
+	s.track.PrintDone()
+	s.stats.Send(StatsRecord{OpType: StatDisplay})
+	s.stats.Flush()
+	for _, job := range s.finished {
+		job.Fini()
+	}
+	s.finished = nil
+	s.track.SetTitle("Clean up")
+	s.track.DisplayReset()
+}
+
+// display follows whatever is furthest along. The run status while jobs are
+// running, otherwise the jobs being prepared or waited on.
+func (s *Scheduler) display() {
+	preparing, waiting := 0, 0
+	for name, b := range s.batches {
+		if b.ready == len(b.names) {
+			continue
+		}
+		switch s.phase[name] {
+		case schedPreparing:
+			preparing++
+		case schedWaiting:
+			waiting++
+		}
+	}
+	switch {
+	case s.running > 0:
+		s.track.SetTitle("Run")
+		s.track.DisplaySet(func() { s.printer.Send("%s", s.stats.Progress()) })
+	case preparing >= 10:
+		s.track.SetTitle("Preparing")
+		s.track.DisplayCount()
+	case preparing > 0:
+		s.track.SetTitle("Preparing")
+		s.track.DisplayExtra()
+	case waiting > 0:
+		s.track.SetTitle("Waiting")
+		s.track.DisplayExtra()
+	}
+}
@@ -0,0 +1,96 @@
+package support
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSchedulerWaitFor(t *testing.T) {
+	// C waits for A, which is done long before B runs out of runtime.
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+record-time=1h
+runtime=1s
+iodepth=4
+size=1g
+access-pattern=100:randread:4k
+
+[job "A"]
+name=null
+number-ios=1000
+
+[job "B"]
+name=null
+number-ios=1000000000
+
+[job "C"]
+name=null
+wait-for=A
+number-ios=1000
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := StatsInit(&cfg.Global, PrintInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Send(StatsRecord{OpType: StatStop})
+
+	s := NewScheduler(cfg, stats, PrintInit())
+	if !s.Run() {
+		t.Fatal("jobs couldn't be set up")
+	}
+	a, b, c := s.jobs["A"].jobStat, s.jobs["B"].jobStat, s.jobs["C"].jobStat
+	if c.startTime.Before(a.endTime) {
+		t.Errorf("C started before A was done")
+	}
+	if !c.endTime.Before(b.endTime) {
+		t.Errorf("C didn't run until B was done, C ended %s, B %s", c.endTime, b.endTime)
+	}
+	if b.stopReason != StopRuntime.String() || c.stopReason != StopNumberIOs.String() {
+		t.Errorf("B ended by %s, C by %s", b.stopReason, c.stopReason)
+	}
+}
+
+func TestSchedulerFillFails(t *testing.T) {
+	// Every write to /dev/full fails, so A's fill does and B, which waits on
+	// it, never runs.
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	cfg, err := readTestConfig(t, `
+[global]
+version=1
+record-time=1h
+runtime=1s
+size=1m
+access-pattern=100:randread:4k
+
+[job "A"]
+name=/dev/full
+force-fill=yes
+allow-destructive=yes
+
+[job "B"]
+name=null
+wait-for=A
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := StatsInit(&cfg.Global, PrintInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Send(StatsRecord{OpType: StatStop})
+
+	s := NewScheduler(cfg, stats, PrintInit())
+	if s.Run() {
+		t.Error("run with a failed fill succeeded")
+	}
+	if _, ok := s.jobs["B"]; ok {
+		t.Error("B ran after A's fill failed")
+	}
+}
@@ -2,6 +2,7 @@ package support
 
 import (
 	"container/list"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -10,6 +11,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -44,12 +47,25 @@ type SlaveState struct {
 	params        *SlaveParams
 	encode        *json.Encoder
 	decode        *json.Decoder
-	threadRunning bool
 	workerCmpt    chan WorkerStat
 	statChan      chan *WorkerStat
 	targetDev     *os.File
 	removeOnClose bool
 	totalStats    WorkerStat
+
+	// state is a JobState. Workers watch ctx rather than the state so a stop
+	// from the master is seen between I/O's without any polling.
+	state  int32
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sendLock keeps the replies from SlaveExecute, slaveRun and
+	// intermediateStats from being interleaved on the connection. An op and
+	// the stats which follow it are sent while holding it once.
+	sendLock sync.Mutex
+
+	// adLock protects the lastBlk positions in params.accessPattern.
+	adLock sync.Mutex
 }
 
 /*
@@ -94,11 +110,18 @@ type SlaveStatReply struct {
 }
 
 func (sc *SlaveController) InitDial() error {
-	var err error
-
-	if sc.SlaveConn, err = net.Dial("tcp", sc.JobConfig.Slave_Host+":6969"); err != nil {
+	conn, err := net.Dial("tcp", sc.JobConfig.Slave_Host+":6969")
+	if err != nil {
 		return fmt.Errorf("failed to connect to %s, err=%s", sc.JobConfig.Slave_Host, err)
 	}
+	return sc.InitConn(conn)
+}
+
+// InitConn sends the job parameters to a slave over an established connection.
+func (sc *SlaveController) InitConn(conn net.Conn) error {
+	var err error
+
+	sc.SlaveConn = conn
 	sc.encode = json.NewEncoder(sc.SlaveConn)
 	sc.decode = json.NewDecoder(sc.SlaveConn)
 
@@ -166,10 +189,23 @@ func (sc *SlaveController) ClientStop() {
 	sc.encode.Encode(&slaveOp)
 }
 
+//
+// SlaveExecute -- handle the requests from a master until it hangs up
+//
+// The slave is prepared once the target is ready, running after a start and
+// draining after a stop until slaveRun has collected every worker and sent the
+// final stats. The connection is only closed here, once the run is done.
+//
 func (s *SlaveState) SlaveExecute(p *Printer) {
 	var err error
 
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	var runDone chan struct{}
 	defer func() {
+		s.cancel()
+		if runDone != nil {
+			<-runDone
+		}
 		s.SlaveConn.Close()
 	}()
 
@@ -190,12 +226,12 @@ func (s *SlaveState) SlaveExecute(p *Printer) {
 		p.Send("Failed to prep target: %s\n", s.params.FileName)
 		return
 	}
+	atomic.StoreInt32(&s.state, int32(JobPrepared))
 	s.sendReply(&SlaveResponse{StatusOkay, "okay"})
 
 	go s.intermediateStats()
 	var slaveOp SlaveOp
-	s.threadRunning = true
-	for s.threadRunning {
+	for {
 		if err = s.decode.Decode(&slaveOp); err != nil {
 			/*
 			 * Look for a means to test the type of error. If the error is EOF
@@ -209,11 +245,20 @@ func (s *SlaveState) SlaveExecute(p *Printer) {
 		case SlaveOpWarmup:
 			s.sendReply(&SlaveResponse{StatusOkay, "okay"})
 		case SlaveOpStart:
-			go s.slaveRun()
+			if !atomic.CompareAndSwapInt32(&s.state, int32(JobPrepared), int32(JobRunning)) {
+				s.sendReply(&SlaveResponse{StatusError, fmt.Sprintf("slave is %s", s.State())})
+				continue
+			}
 			s.sendReply(&SlaveResponse{StatusOkay, "okay"})
+			runDone = make(chan struct{})
+			go func() {
+				defer close(runDone)
+				s.slaveRun()
+			}()
 		case SlaveOpStop:
 			p.Send("STOP requested\n")
-			s.threadRunning = false
+			atomic.CompareAndSwapInt32(&s.state, int32(JobRunning), int32(JobDraining))
+			s.cancel()
 			s.sendReply(&SlaveResponse{StatusOkay, "okay"})
 		default:
 			p.Send("Invalid slave operation: %d\n", slaveOp.OpType)
@@ -222,6 +267,11 @@ func (s *SlaveState) SlaveExecute(p *Printer) {
 	}
 }
 
+// State returns where the slave is in its lifecycle.
+func (s *SlaveState) State() JobState {
+	return JobState(atomic.LoadInt32(&s.state))
+}
+
 func (s *SlaveState) prepTarget() bool {
 	var err error
 	var fileInfo os.FileInfo
@@ -355,7 +405,6 @@ func (s *SlaveState) slaveRun() {
 	avgCount := 0
 
 	defer func() {
-		s.SlaveConn.Close()
 		if s.removeOnClose {
 			os.Remove(s.params.FileName)
 		}
@@ -385,10 +434,12 @@ func (s *SlaveState) slaveRun() {
 			s.totalStats.AvgResponse = avgResponse / time.Duration(avgCount)
 			s.totalStats.Elapsed = time.Now().Sub(start)
 
-			s.sendReply(&SlaveOp{OpType: SlaveFinishedStats})
-			s.sendReply(&SlaveStatReply{SlaveName: s.params.JobName, SlaveStats: s.totalStats})
-			s.sendReply(&SlaveOp{OpType: SlaveFinished})
-			s.threadRunning = false
+			// Stop intermediateStats before the final numbers go out.
+			s.cancel()
+			atomic.StoreInt32(&s.state, int32(JobDone))
+			s.sendReply(&SlaveOp{OpType: SlaveFinishedStats},
+				&SlaveStatReply{SlaveName: s.params.JobName, SlaveStats: s.totalStats},
+				&SlaveOp{OpType: SlaveFinished})
 			if s.params.Verbose {
 				DebugDisable()
 			}
@@ -403,6 +454,8 @@ func (s *SlaveState) intermediateStats() {
 	checkin := 0
 	for {
 		select {
+		case <-s.ctx.Done():
+			return
 		case ws := <-s.statChan:
 			s.addStats(thrStats, ws)
 			checkin++
@@ -410,8 +463,8 @@ func (s *SlaveState) intermediateStats() {
 				continue
 			}
 			checkin = 0
-			s.sendReply(&SlaveOp{OpType: SlaveIntermediateStats})
-			s.sendReply(&SlaveStatReply{SlaveName: s.params.JobName, SlaveStats: *thrStats})
+			s.sendReply(&SlaveOp{OpType: SlaveIntermediateStats},
+				&SlaveStatReply{SlaveName: s.params.JobName, SlaveStats: *thrStats})
 			thrStats = &WorkerStat{}
 			thrStats.Histogram = DistroInit(nil, "")
 		}
@@ -453,10 +506,35 @@ func (s *SlaveState) addStats(parent, w *WorkerStat) {
 	DebugDecrase()
 }
 
-func (s *SlaveState) sendReply(v interface{}) {
-	if err := s.encode.Encode(v); err != nil {
-		s.printer.Send("sendReply error: err=%s\n", err)
+// sendReply encodes each of vals back to back so that no other thread's reply
+// ends up between them.
+func (s *SlaveState) sendReply(vals ...interface{}) {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	for _, v := range vals {
+		if err := s.encode.Encode(v); err != nil {
+			s.printer.Send("sendReply error: err=%s\n", err)
+			return
+		}
+	}
+}
+
+// snapshot copies the worker's stats, including the histogram, so they can be
+// handed to intermediateStats while the worker keeps adding to its own.
+func (ws *WorkerStat) snapshot() *WorkerStat {
+	c := *ws
+	h := *ws.Histogram
+	h.Bins = append([]int64(nil), ws.Histogram.Bins...)
+	c.Histogram = &h
+	return &c
+}
+
+// average guards against a worker which never got an I/O in.
+func average(total time.Duration, count int) time.Duration {
+	if count == 0 {
+		return 0
 	}
+	return total / time.Duration(count)
 }
 
 func (s *SlaveState) slaveWorker(id int) {
@@ -467,15 +545,25 @@ func (s *SlaveState) slaveWorker(id int) {
 
 	lastBufSize := int64(0)
 	stats.Histogram = DistroInit(nil, "")
-	tick := time.Tick(time.Second)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	tick := ticker.C
 	boom := time.After(s.params.Runtime)
 	stats.LowResponse = time.Hour * 24
-	for s.threadRunning {
+	for {
 		select {
+		case <-s.ctx.Done():
+			stats.AvgResponse = average(totalLatency, totalCount)
+			s.workerCmpt <- stats
+			s.printer.Send("[%d] thread halted\n", id)
+			return
 		case <-tick:
-			s.statChan <- &stats
+			select {
+			case s.statChan <- stats.snapshot():
+			case <-s.ctx.Done():
+			}
 		case <-boom:
-			stats.AvgResponse = totalLatency / time.Duration(totalCount)
+			stats.AvgResponse = average(totalLatency, totalCount)
 			s.workerCmpt <- stats
 			return
 		default:
@@ -511,12 +599,11 @@ func (s *SlaveState) slaveWorker(id int) {
 			totalLatency += latency
 		}
 	}
-	stats.AvgResponse = totalLatency / time.Duration(totalCount)
-	s.workerCmpt <- stats
-	s.printer.Send("[%d] thread halted\n", id)
 }
 
 func (s *SlaveState) oneAD() AccessData {
+	s.adLock.Lock()
+	defer s.adLock.Unlock()
 	ad := AccessData{}
 	section := rand.Intn(100)
 	/*
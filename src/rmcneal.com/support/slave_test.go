@@ -1,6 +1,13 @@
 package support
 
-import "testing"
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
 
 func TestStatsAdd(t *testing.T) {
 	ws := WorkerStat{}
@@ -10,9 +17,53 @@ func TestStatsAdd(t *testing.T) {
 	ss.totalStats.Histogram = &DistroGraph{}
 	ss.totalStats.BytesRead = 13
 	DebugEnable()
-	ss.addStats(&ws)
+	ss.addStats(&ss.totalStats, &ws)
 	DebugDisable()
 	if ss.totalStats.BytesRead != 113 {
 		t.Errorf("BytesRead(%d) != 113\n", ss.totalStats.BytesRead)
 	}
 }
+
+// TestSlaveStop runs a master and slave over a pipe and stops the slave well
+// before its runtime. The slave must still send its final stats.
+func TestSlaveStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fiod-slave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	master, slave := net.Pipe()
+	ss := &SlaveState{SlaveConn: slave}
+	executed := make(chan struct{})
+	go func() {
+		defer close(executed)
+		ss.SlaveExecute(PrintInit())
+	}()
+
+	jd := &JobData{Name: filepath.Join(dir, "target"), IODepth: 2, fileSize: 1024 * 1024,
+		runtime: time.Minute, Access_Pattern: "100:rw:4k"}
+	sc := &SlaveController{JobConfig: jd, Name: "slave", StatChan: make(chan WorkerStat, 100)}
+	if err := sc.InitConn(master); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.ClientStart(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sc.ClientStop()
+	if err := sc.ClientWait(); err != nil {
+		t.Fatal(err)
+	}
+	<-executed
+
+	if sc.Stats.Reads+sc.Stats.Writes == 0 {
+		t.Error("final stats are empty")
+	}
+	if s := ss.State(); s != JobDone {
+		t.Errorf("slave is %s", s)
+	}
+	if _, err := os.Stat(jd.Name); !os.IsNotExist(err) {
+		t.Errorf("target wasn't removed: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"runtime"
 	"time"
 	"io"
 	"net"
@@ -20,6 +21,11 @@ const (
 	StatStop
 	StatSetHistogram
 	StatFlush
+	StatAddJob
+	StatRampDone
+	StatLogInterval
+	StatJobDone
+	StatProgress
 )
 
 type StatsRecord struct {
@@ -29,6 +35,11 @@ type StatsRecord struct {
 	opDuration time.Duration
 	opStr      string
 	opIdx      int
+	job        *jobStats
+	section    int
+
+	// The jobs being started by a StatClear.
+	group []*jobStats
 }
 
 type StatsState struct {
@@ -43,6 +54,23 @@ type StatsState struct {
 	runtime     time.Duration
 	printer     *Printer
 	latency     *DistroGraph
+	jobs        []*jobStats
+	rampPending int
+	results     []*JobResult
+
+	// Jobs started and not yet done. The counters are only cleared when
+	// a group of jobs starts with nothing else running. Jobs which join
+	// while others are running just have their own counters cleared.
+	running int
+
+	// Jobs started with the ones still ramping. Their I/O is kept out of
+	// the totals and their own counters start again once the last ramp is
+	// over, leaving the totals of jobs which were already running alone.
+	rampGroup []*jobStats
+
+	// Heap and GC numbers when the counters were last cleared, the verbose
+	// summary shows how much the run added.
+	memStart runtime.MemStats
 
 	// From here to the end of the structure field names
 	// will start with an upper case character so that
@@ -94,6 +122,7 @@ func StatsInit(global *JobData, printer *Printer) (*StatsState, error) {
 	// Set the low latency statistic to a high value to start with.
 	s.ReadLatLow = time.Duration(^uint64(0) >> 1)
 	s.WriteLatLow = time.Duration(^uint64(0) >> 1)
+	runtime.ReadMemStats(&s.memStart)
 
 	if fp, err := os.OpenFile(global.Record_File, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666); err != nil {
 		return nil, err
@@ -114,6 +143,12 @@ func StatsInit(global *JobData, printer *Printer) (*StatsState, error) {
 	return s, nil
 }
 
+// Results returns the numbers for every job which has completed. Only valid
+// after a Flush().
+func (s *StatsState) Results() []*JobResult {
+	return s.results
+}
+
 func (s *StatsState) NextHistogramIdx() int {
 	idx := s.HistoNextAvail
 	s.HistoNextAvail++
@@ -125,14 +160,52 @@ func (s *StatsState) Flush() string {
 	return <-s.statusChans
 }
 
+// StartJobs resets the counters for a group of jobs which are about to start.
+// It waits for the stats thread so that no I/O from them is lost.
+func (s *StatsState) StartJobs(jobs []*Job) {
+	group := make([]*jobStats, len(jobs))
+	for i, j := range jobs {
+		group[i] = j.jobStat
+	}
+	s.Send(StatsRecord{OpType: StatClear, group: group})
+	s.Flush()
+}
+
+// Progress returns the one line run status. The counters belong to the stats
+// thread so it's built there instead of by the caller.
+func (s *StatsState) Progress() string {
+	s.Send(StatsRecord{OpType: StatProgress})
+	return <-s.statusChans
+}
+
 func (s *StatsState) StatsWorker() {
 	keepRunning := true
 	recordMarkers := time.Tick(s.gcfg.recordTime)
+	var intermediate <-chan time.Time
+	if s.gcfg.intermediateStats > 0 {
+		intermediate = time.Tick(s.gcfg.intermediateStats)
+	}
+	// Keeps the once a second progress display current for jobs which
+	// record into shards.
+	mergeTick := time.Tick(time.Second)
 	var recordIOPS, recordRead, recordWrite int64 = 0, 0, 0
 
 	for keepRunning {
 		select {
 		case r := <-s.incoming:
+			switch r.OpType {
+			case StatJobDone, StatLogInterval, StatFlush, StatDisplay, StatProgress:
+				s.mergeShards()
+			}
+			if (r.OpType == StatRead || r.OpType == StatWrite) && r.job != nil {
+				if !r.job.started {
+					break
+				}
+				r.job.record(&r)
+				if r.job.ramping {
+					break
+				}
+			}
 			switch r.OpType {
 			case StatRead:
 				s.Iops++
@@ -169,14 +242,64 @@ func (s *StatsState) StatsWorker() {
 				s.latency.Aggregate(r.opDuration)
 
 			case StatClear:
-				ClearStruct(s)
-				s.ReadLatLow = time.Duration(^uint64(0) >> 1)
-				s.WriteLatLow = time.Duration(^uint64(0) >> 1)
-				s.StartTime = time.Now()
-				s.SampleSpeed = map[int]int64{}
-				s.runtime = s.gcfg.runtime
-				_, _ = fmt.Fprintln(s.fp, "# ---- Barrier request ----")
-				recordIOPS, recordRead, recordWrite = 0, 0, 0
+				if s.running == 0 {
+					s.clearCounters()
+					_, _ = fmt.Fprintln(s.fp, "# ---- Barrier request ----")
+					recordIOPS, recordRead, recordWrite = 0, 0, 0
+				} else {
+					for _, js := range r.group {
+						js.clear()
+					}
+				}
+				s.running += len(r.group)
+				for _, js := range r.group {
+					js.started = true
+					if js.params.rampTime > 0 {
+						s.rampPending++
+					}
+				}
+				if s.rampPending != 0 {
+					for _, js := range r.group {
+						js.ramping = true
+					}
+					s.rampGroup = append(s.rampGroup, r.group...)
+				}
+
+			case StatAddJob:
+				s.jobs = append(s.jobs, r.job)
+
+			case StatRampDone:
+				// Jobs with a ramp-time don't send any records until their ramp
+				// is over. Once the last one started with them is done restart
+				// the clock so that the reported runtime doesn't include the ramp.
+				s.rampPending--
+				if s.rampPending == 0 {
+					s.endRamp()
+					if s.Iops == 0 {
+						// Nothing else has been counted so the clock
+						// can start again for everyone. The latency
+						// histogram isn't one of the fields
+						// ClearStruct() resets.
+						s.clearTotals()
+						s.latency.Clear()
+						recordIOPS, recordRead, recordWrite = 0, 0, 0
+					}
+				}
+
+			case StatJobDone:
+				r.job.endTime = time.Now()
+				r.job.cpuEnd = takeCPUSample()
+				if r.job.disk != nil {
+					r.job.disk.finish(r.job.endTime)
+				}
+				r.job.stopReason = r.opStr
+				r.job.errors = r.opSize
+				if s.running > 0 {
+					s.running--
+				}
+
+			case StatLogInterval:
+				r.job.logInterval(time.Now())
 
 			case StatSetHistogram:
 				var width int
@@ -197,15 +320,39 @@ func (s *StatsState) StatsWorker() {
 				 * ops have been dealt with so send an ack back.
 				 */
 				s.statusChans <- "stats flushed"
+			case StatProgress:
+				s.statusChans <- s.String()
 			case StatDisplay:
+				// Jobs which are still being prepared are left for the
+				// next group.
+				var pending []*jobStats
+				all := s.jobs
+				s.jobs = nil
+				for _, js := range all {
+					if js.endTime.IsZero() {
+						pending = append(pending, js)
+					} else {
+						s.jobs = append(s.jobs, js)
+					}
+				}
 				s.StatsDump()
+				for _, js := range s.jobs {
+					s.results = append(s.results, js.result())
+				}
+				s.jobs = pending
+				s.rampPending = 0
+				s.endRamp()
 			case StatStop:
 				keepRunning = false
 			default:
 				s.printer.Send("Bad stat op request: op_type=%d\n", r.OpType)
 			}
 
+		case <-mergeTick:
+			s.mergeShards()
+
 		case t := <-recordMarkers:
+			s.mergeShards()
 			ct := t.Unix()
 			_, _ = fmt.Fprintf(s.fiow, "%s-read %d %d\n", s.gcfg.Graphite_Metric,
 				s.ReadBW-recordRead, ct)
@@ -219,12 +366,63 @@ func (s *StatsState) StatsWorker() {
 			recordIOPS = s.Iops
 			recordRead = s.ReadBW
 			recordWrite = s.WriteBW
+
+			for _, js := range s.jobs {
+				js.sample(s.gcfg.recordTime)
+			}
+
+		case <-intermediate:
+			s.mergeShards()
+			s.intermediateDump()
 		}
 	}
 
 	s.statusChans <- "stat channel"
 }
 
+// endRamp starts the counters of the jobs which were held back by a ramp.
+func (s *StatsState) endRamp() {
+	for _, js := range s.rampGroup {
+		js.ramping = false
+		js.clear()
+	}
+	s.rampGroup = nil
+}
+
+func (s *StatsState) clearCounters() {
+	s.clearTotals()
+	for _, js := range s.jobs {
+		js.clear()
+	}
+}
+
+// clearTotals starts the summary of every job over again.
+func (s *StatsState) clearTotals() {
+	ClearStruct(s)
+	s.ReadLatLow = time.Duration(^uint64(0) >> 1)
+	s.WriteLatLow = time.Duration(^uint64(0) >> 1)
+	s.StartTime = time.Now()
+	s.SampleSpeed = map[int]int64{}
+	s.runtime = s.gcfg.runtime
+	runtime.ReadMemStats(&s.memStart)
+}
+
+// memoryUsage describes the allocation and garbage collection done since the
+// counters were cleared along with the number of I/O buffers the jobs made.
+func (s *StatsState) memoryUsage() string {
+	var now runtime.MemStats
+	runtime.ReadMemStats(&now)
+	var bufs int64
+	for _, js := range s.jobs {
+		if js.bufs != nil {
+			bufs += js.bufs.Allocations()
+		}
+	}
+	return fmt.Sprintf("Memory: allocs=%d (%s), GC cycles=%d, GC pause=%s, I/O buffers=%d",
+		now.Mallocs-s.memStart.Mallocs, Humanize(int64(now.TotalAlloc-s.memStart.TotalAlloc), 1),
+		now.NumGC-s.memStart.NumGC, time.Duration(now.PauseTotalNs-s.memStart.PauseTotalNs), bufs)
+}
+
 func (s *StatsState) String() string {
 	var buffer bytes.Buffer
 
@@ -279,6 +477,11 @@ func (s *StatsState) StatsDump() {
 	runTime := time.Now().Sub(s.StartTime)
 
 	s.groupPrintStart()
+	for _, js := range s.jobs {
+		if js.params.sweepLabel != "" {
+			s.groupPrint("[%s] %s\n", js.name, js.params.sweepLabel)
+		}
+	}
 	s.latency.Graph(true)
 
 	if s.ReadIOPS != 0 {
@@ -333,6 +536,56 @@ func (s *StatsState) StatsDump() {
 		s.groupPrint("IO's(read=%d,write=%d), Bytes xfer'd(read=%d,write=%d)\n", s.ReadIOPS, s.WriteIOPS,
 			s.ReadBW, s.WriteBW)
 	}
+	if s.gcfg.Verbose {
+		s.groupPrint("%s\n", s.memoryUsage())
+	}
+	for _, js := range s.jobs {
+		if sections := js.sectionResults(js.runtime()); sections != nil {
+			s.groupPrint("Sections [%s]\n%s\n", js.name, sectionTable(sections))
+		}
+	}
+	for _, js := range s.jobs {
+		s.groupPrint("CPU [%s]: %s\n", js.name, js.cpu())
+		if js.disk != nil {
+			if dev := js.disk.result(); dev != nil {
+				s.groupPrint("Device [%s] %s\n", js.name, dev)
+			}
+		}
+	}
+	for _, js := range s.jobs {
+		if js.steady != nil {
+			s.groupPrint("Steady state [%s]: %s\n", js.name, js.steady)
+		}
+	}
+	for _, js := range s.jobs {
+		if js.stopReason != "" && js.stopReason != StopRuntime.String() {
+			s.groupPrint("Stopped [%s]: %s\n", js.name, js.stopReason)
+		}
+	}
+	s.groupPrintEnd()
+}
+
+// intermediateDump gives a short progress report during long runs. Unlike
+// StatsDump() nothing is changed so that the final summary is still correct.
+func (s *StatsState) intermediateDump() {
+	runTime := time.Now().Sub(s.StartTime)
+	if s.Iops == 0 || int64(runTime.Seconds()) == 0 {
+		return
+	}
+	secs := int64(runTime.Seconds())
+	s.groupPrintStart()
+	s.groupPrint("\n---- Intermediate stats [%s] ----\n", SecsToHMSstr(int(secs)))
+	s.groupPrint("IOPS: %s, Bandwidth: %s (r:%s,w:%s), P99: %s\n",
+		Humanize(s.Iops/secs, 1),
+		Humanize((s.ReadBW+s.WriteBW)/secs, 1),
+		Humanize(s.ReadBW/secs, 1),
+		Humanize(s.WriteBW/secs, 1),
+		s.latency.Percentile(99))
+	if len(s.jobs) > 1 {
+		for _, js := range s.jobs {
+			s.groupPrint("  %s\n", js)
+		}
+	}
 	s.groupPrintEnd()
 }
 
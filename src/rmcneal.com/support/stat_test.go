@@ -0,0 +1,167 @@
+package support
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testStats(t testing.TB, pattern string, workers int) (*StatsState, *jobStats) {
+	global := &JobData{Record_File: os.DevNull, recordTime: time.Hour}
+	s, err := StatsInit(global, PrintInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jd := &JobData{Access_Pattern: pattern, fileSize: 100 * 1024 * 1024}
+	if err := jd.parseAccessPattern(); err != nil {
+		t.Fatal(err)
+	}
+	js := newJobStats("test", jd, nil, nil)
+	js.addShards(workers, s.latency)
+	s.Send(StatsRecord{OpType: StatAddJob, job: js})
+	s.Send(StatsRecord{OpType: StatClear, group: []*jobStats{js}})
+	s.Flush()
+	return s, js
+}
+
+func TestStatShards(t *testing.T) {
+	s, js := testStats(t, "50:randread:4k,50:write:8k", 2)
+	defer s.Send(StatsRecord{OpType: StatStop})
+
+	js.shards[0].record(StatRead, 4096, 2*time.Millisecond, 0)
+	js.shards[1].record(StatRead, 4096, time.Millisecond, 0)
+	js.shards[1].record(StatWrite, 8192, 3*time.Millisecond, 1)
+	s.Flush()
+	if js.total.readIOs != 2 || js.total.writeBW != 8192 || js.sections[1].writeIOs != 1 {
+		t.Errorf("totals after first merge: %+v", js.total)
+	}
+	if s.Iops != 3 || s.ReadLatLow != time.Millisecond || s.ReadLatHigh != 2*time.Millisecond ||
+		s.WriteLatHigh != 3*time.Millisecond || s.latency.Count() != 3 {
+		t.Errorf("global stats: iops %d, read low %s high %s, write high %s", s.Iops, s.ReadLatLow,
+			s.ReadLatHigh, s.WriteLatHigh)
+	}
+
+	// Only what's new is added by the next merge.
+	js.shards[0].record(StatRead, 4096, time.Millisecond, 0)
+	s.Flush()
+	if js.total.readIOs != 3 || js.total.latency.Count() != 4 || s.ReadLatAvg != 4*time.Millisecond {
+		t.Errorf("second merge: %d reads, %d latencies", js.total.readIOs, js.total.latency.Count())
+	}
+
+	// Once the job is done the next barrier starts everything over.
+	s.Send(StatsRecord{OpType: StatJobDone, job: js, opStr: StopRuntime.String()})
+	s.Send(StatsRecord{OpType: StatClear, group: []*jobStats{js}})
+	s.Flush()
+	if js.total.readIOs != 0 || s.Iops != 0 {
+		t.Errorf("clear left %d reads", js.total.readIOs)
+	}
+}
+
+func TestStatRampGroup(t *testing.T) {
+	s, a := testStats(t, "100:randread:4k", 1)
+	defer s.Send(StatsRecord{OpType: StatStop})
+	a.shards[0].record(StatRead, 4096, time.Millisecond, 0)
+	s.Flush()
+
+	// D is still filling its target. None of that is counted and it's thrown
+	// away once D starts.
+	d := newJobStats("D", a.params, nil, nil)
+	d.addShards(1, s.latency)
+	s.Send(StatsRecord{OpType: StatAddJob, job: d})
+	d.shards[0].record(StatWrite, 1024*1024, 10*time.Millisecond, 0)
+	s.Send(StatsRecord{OpType: StatWrite, opSize: 1024 * 1024, opDuration: 10 * time.Millisecond, job: d})
+	s.Flush()
+	if s.Iops != 1 || s.WriteBW != 0 || s.WriteLatHigh != 0 || s.latency.Count() != 1 || d.total.writeIOs != 0 {
+		t.Errorf("while D fills: iops %d, write B/W %d, %d latencies, D has %d writes", s.Iops,
+			s.WriteBW, s.latency.Count(), d.total.writeIOs)
+	}
+
+	// B ramps and C started with it. Nothing from C is counted until the
+	// ramp is over and A, which started before them, keeps its numbers.
+	var group []*jobStats
+	for i, ramp := range []time.Duration{time.Second, 0} {
+		jd := &JobData{Access_Pattern: "100:randread:4k", fileSize: 100 * 1024 * 1024, rampTime: ramp}
+		if err := jd.parseAccessPattern(); err != nil {
+			t.Fatal(err)
+		}
+		js := newJobStats(string(rune('B'+i)), jd, nil, nil)
+		js.addShards(1, s.latency)
+		s.Send(StatsRecord{OpType: StatAddJob, job: js})
+		group = append(group, js)
+	}
+	s.Send(StatsRecord{OpType: StatClear, group: group})
+	s.Flush()
+	c := group[1]
+	c.shards[0].record(StatRead, 4096, time.Millisecond, 0)
+	s.Send(StatsRecord{OpType: StatRead, opSize: 4096, opDuration: time.Millisecond, job: c})
+	a.shards[0].record(StatRead, 4096, time.Millisecond, 0)
+	s.Flush()
+	if s.Iops != 2 || s.latency.Count() != 2 || c.total.readIOs != 2 {
+		t.Errorf("during the ramp: iops %d, %d latencies, C has %d reads", s.Iops,
+			s.latency.Count(), c.total.readIOs)
+	}
+
+	s.Send(StatsRecord{OpType: StatRampDone})
+	s.Flush()
+	if s.Iops != 2 || a.total.readIOs != 2 || c.total.readIOs != 0 {
+		t.Errorf("after the ramp: iops %d, A has %d reads, C has %d", s.Iops,
+			a.total.readIOs, c.total.readIOs)
+	}
+	c.shards[0].record(StatRead, 4096, time.Millisecond, 0)
+	s.Flush()
+	if s.Iops != 3 || c.total.readIOs != 1 {
+		t.Errorf("C isn't counted after the ramp: iops %d, C has %d reads", s.Iops, c.total.readIOs)
+	}
+
+	s.Send(StatsRecord{OpType: StatClear, group: []*jobStats{d}})
+	s.Flush()
+	d.shards[0].record(StatWrite, 4096, time.Millisecond, 0)
+	s.Flush()
+	if s.Iops != 4 || s.WriteBW != 4096 || d.total.writeIOs != 1 || d.total.writeBW != 4096 {
+		t.Errorf("after D starts: iops %d, write B/W %d, D has %d writes of %d bytes", s.Iops,
+			s.WriteBW, d.total.writeIOs, d.total.writeBW)
+	}
+}
+
+// benchmarkStats has eight workers account for b.N reads either by sending each
+// one to the stats thread or by recording into their own shard.
+func benchmarkStats(b *testing.B, sharded bool) {
+	const workers = 8
+	s, js := testStats(b, "100:randread:4k", workers)
+	defer s.Send(StatsRecord{OpType: StatStop})
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		n := b.N / workers
+		if w == 0 {
+			n += b.N % workers
+		}
+		wg.Add(1)
+		go func(w, n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if sharded {
+					js.shards[w].record(StatRead, 4096, time.Microsecond, 0)
+				} else {
+					s.Send(StatsRecord{OpType: StatRead, opSize: 4096, opDuration: time.Microsecond, job: js})
+				}
+			}
+		}(w, n)
+	}
+	wg.Wait()
+	s.Flush()
+	b.StopTimer()
+	if js.total.readIOs != int64(b.N) {
+		b.Fatalf("counted %d of %d reads", js.total.readIOs, b.N)
+	}
+}
+
+func BenchmarkStatsChannel(b *testing.B) {
+	benchmarkStats(b, false)
+}
+
+func BenchmarkStatsSharded(b *testing.B) {
+	benchmarkStats(b, true)
+}
@@ -0,0 +1,203 @@
+package support
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// shardCounters is one access pattern section's part of a statShard. The
+// latency buckets match the exponential graph used by ioCounters.
+type shardCounters struct {
+	readIOs  int64
+	writeIOs int64
+	readBW   int64
+	writeBW  int64
+	readLat  int64
+	writeLat int64
+	bins     [64]int64
+}
+
+//
+// statShard -- where a single worker accounts for its I/O's
+//
+// Sending every I/O to the StatsWorker thread over a channel limits how many
+// I/O's a second can be counted. Instead each worker adds to its own shard
+// using atomic operations and the stats thread merges whatever has changed
+// since it last looked. Only the worker writes the counters and only the stats
+// thread uses the seen copies.
+//
+type statShard struct {
+	sections []shardCounters
+
+	// Same buckets as StatsState.latency, which may be a linear graph.
+	global []int64
+	distro *DistroGraph
+
+	// Lowest and highest latency since the last merge.
+	readLow   int64
+	readHigh  int64
+	writeLow  int64
+	writeHigh int64
+
+	seen       []shardCounters
+	seenGlobal []int64
+}
+
+func newStatShard(sections int, distro *DistroGraph) *statShard {
+	sh := &statShard{sections: make([]shardCounters, sections), seen: make([]shardCounters, sections),
+		global: make([]int64, len(distro.Bins)), seenGlobal: make([]int64, len(distro.Bins)), distro: distro}
+	sh.readLow, sh.writeLow = math.MaxInt64, math.MaxInt64
+	return sh
+}
+
+// addShards gives each of the job's workers a shard to record into. Must be
+// done before the job is handed to the stats thread.
+func (js *jobStats) addShards(workers int, distro *DistroGraph) {
+	js.shards = make([]*statShard, workers)
+	for i := range js.shards {
+		js.shards[i] = newStatShard(len(js.sections), distro)
+	}
+}
+
+// record is called by the worker which owns the shard after each I/O.
+func (sh *statShard) record(op int, size int64, dur time.Duration, section int) {
+	c := &sh.sections[section]
+	lat := int64(dur)
+	switch op {
+	case StatRead:
+		atomic.AddInt64(&c.readIOs, 1)
+		atomic.AddInt64(&c.readBW, size)
+		atomic.AddInt64(&c.readLat, lat)
+		lowHigh(&sh.readLow, &sh.readHigh, lat)
+	case StatWrite:
+		atomic.AddInt64(&c.writeIOs, 1)
+		atomic.AddInt64(&c.writeBW, size)
+		atomic.AddInt64(&c.writeLat, lat)
+		lowHigh(&sh.writeLow, &sh.writeHigh, lat)
+	}
+	atomic.AddInt64(&c.bins[expBin(dur)], 1)
+	atomic.AddInt64(&sh.global[sh.distro.bin(dur)], 1)
+}
+
+// lowHigh updates the extremes. The stats thread resets them while the worker
+// is running so compare and swap is used instead of a plain store.
+func lowHigh(low, high *int64, lat int64) {
+	for old := atomic.LoadInt64(low); lat < old; old = atomic.LoadInt64(low) {
+		if atomic.CompareAndSwapInt64(low, old, lat) {
+			break
+		}
+	}
+	for old := atomic.LoadInt64(high); lat > old; old = atomic.LoadInt64(high) {
+		if atomic.CompareAndSwapInt64(high, old, lat) {
+			break
+		}
+	}
+}
+
+// delta sets d to what's been added to section idx since the last call.
+func (sh *statShard) delta(idx int, d *shardCounters) {
+	c, seen := &sh.sections[idx], &sh.seen[idx]
+	for _, f := range []struct{ cur, seen, out *int64 }{
+		{&c.readIOs, &seen.readIOs, &d.readIOs},
+		{&c.writeIOs, &seen.writeIOs, &d.writeIOs},
+		{&c.readBW, &seen.readBW, &d.readBW},
+		{&c.writeBW, &seen.writeBW, &d.writeBW},
+		{&c.readLat, &seen.readLat, &d.readLat},
+		{&c.writeLat, &seen.writeLat, &d.writeLat},
+	} {
+		v := atomic.LoadInt64(f.cur)
+		*f.out = v - *f.seen
+		*f.seen = v
+	}
+	for k := range c.bins {
+		v := atomic.LoadInt64(&c.bins[k])
+		d.bins[k] = v - seen.bins[k]
+		seen.bins[k] = v
+	}
+}
+
+// reset throws away everything recorded so far.
+func (sh *statShard) reset() {
+	var d shardCounters
+	for i := range sh.sections {
+		sh.delta(i, &d)
+	}
+	for k := range sh.global {
+		sh.seenGlobal[k] = atomic.LoadInt64(&sh.global[k])
+	}
+	sh.resetLowHigh()
+}
+
+func (sh *statShard) resetLowHigh() {
+	atomic.StoreInt64(&sh.readLow, math.MaxInt64)
+	atomic.StoreInt64(&sh.writeLow, math.MaxInt64)
+	atomic.StoreInt64(&sh.readHigh, 0)
+	atomic.StoreInt64(&sh.writeHigh, 0)
+}
+
+func (c *ioCounters) merge(d *shardCounters) {
+	c.readIOs += d.readIOs
+	c.writeIOs += d.writeIOs
+	c.readBW += d.readBW
+	c.writeBW += d.writeBW
+	c.readLat += time.Duration(d.readLat)
+	c.writeLat += time.Duration(d.writeLat)
+	for k, v := range d.bins {
+		c.latency.Bins[k] += v
+	}
+}
+
+// mergeShards brings the counters up to date with what the workers of every
+// job have recorded in their shards. A job which hasn't started yet is left
+// alone, what it writes filling its target is thrown away when it starts.
+func (s *StatsState) mergeShards() {
+	var d shardCounters
+	for _, js := range s.jobs {
+		if !js.started {
+			continue
+		}
+		for _, sh := range js.shards {
+			for i := range sh.sections {
+				sh.delta(i, &d)
+				js.total.merge(&d)
+				js.interval.merge(&d)
+				js.sections[i].merge(&d)
+				if js.ramping {
+					continue
+				}
+
+				s.Iops += d.readIOs + d.writeIOs
+				s.ReadIOPS += d.readIOs
+				s.WriteIOPS += d.writeIOs
+				s.ReadBW += d.readBW
+				s.WriteBW += d.writeBW
+				s.ReadLatAvg += time.Duration(d.readLat)
+				s.WriteLatAvg += time.Duration(d.writeLat)
+			}
+			for k := range sh.global {
+				v := atomic.LoadInt64(&sh.global[k])
+				if !js.ramping {
+					s.latency.Bins[k] += v - sh.seenGlobal[k]
+				}
+				sh.seenGlobal[k] = v
+			}
+			if js.ramping {
+				sh.resetLowHigh()
+				continue
+			}
+			if v := time.Duration(atomic.SwapInt64(&sh.readLow, math.MaxInt64)); v < s.ReadLatLow {
+				s.ReadLatLow = v
+			}
+			if v := time.Duration(atomic.SwapInt64(&sh.writeLow, math.MaxInt64)); v < s.WriteLatLow {
+				s.WriteLatLow = v
+			}
+			if v := time.Duration(atomic.SwapInt64(&sh.readHigh, 0)); v > s.ReadLatHigh {
+				s.ReadLatHigh = v
+			}
+			if v := time.Duration(atomic.SwapInt64(&sh.writeHigh, 0)); v > s.WriteLatHigh {
+				s.WriteLatHigh = v
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package support
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/gcfg.v1/token"
+)
+
+// sweepParam is a single option in a job which uses one or more sweep(...)
+// lists. Each list is one dimension of the sweep.
+type sweepParam struct {
+	key    string
+	value  string
+	tokens []string
+	lists  [][]string
+}
+
+var sweepRE = regexp.MustCompile(`sweep\(([^)]*)\)`)
+var sectionRE = regexp.MustCompile(`^\s*\[\s*(\w+)\s*(?:"(.*)")?\s*]`)
+
+//
+// extractSweeps -- find the sweep(...) values in a job file
+//
+// gcfg doesn't know anything about sweeps and would fail to parse sweep(1,2,4) for
+// an integer option. So, each sweep is replaced with its first value before the file
+// is handed to gcfg and the lists are returned by job name. Line numbers are left
+// unchanged so gcfg errors still point at the right place.
+//
+func extractSweeps(filename string, src []byte) (string, map[string][]*sweepParam, error) {
+	var out bytes.Buffer
+	sweeps := map[string][]*sweepParam{}
+	sect, sub := "", ""
+	lineNum := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+		if m := sectionRE.FindStringSubmatch(line); m != nil {
+			sect, sub = strings.ToLower(m[1]), m[2]
+		} else if idx := strings.Index(line, "="); idx != -1 && sweepRE.MatchString(line[idx:]) &&
+			!strings.HasPrefix(strings.TrimSpace(line), ";") && !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			if sect != "job" {
+				return "", nil, &ConfigError{Pos: token.Position{Filename: filename, Line: lineNum, Column: idx + 2},
+					Msg: "sweep only allowed in job sections"}
+			}
+			p := &sweepParam{key: strings.TrimSpace(line[:idx]), value: strings.TrimSpace(line[idx+1:])}
+			for _, m := range sweepRE.FindAllStringSubmatch(p.value, -1) {
+				var list []string
+				for _, v := range strings.Split(m[1], ",") {
+					if v = strings.TrimSpace(v); v != "" {
+						list = append(list, v)
+					}
+				}
+				if len(list) == 0 {
+					return "", nil, &ConfigError{Pos: token.Position{Filename: filename, Line: lineNum, Column: idx + 2},
+						Msg: "empty sweep list"}
+				}
+				p.tokens = append(p.tokens, m[0])
+				p.lists = append(p.lists, list)
+			}
+			sweeps[sub] = append(sweeps[sub], p)
+			line = line[:idx+1] + sweepRE.ReplaceAllStringFunc(line[idx+1:], func(tok string) string {
+				return strings.TrimSpace(strings.Split(sweepRE.FindStringSubmatch(tok)[1], ",")[0])
+			})
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.String(), sweeps, scanner.Err()
+}
+
+// sweepCombinations returns every value of the option for each point in the sweep
+// along with the labels for each point. The first dimension changes slowest.
+func sweepCombinations(params []*sweepParam) ([]map[string]string, []string) {
+	var dims [][]string
+	for _, p := range params {
+		dims = append(dims, p.lists...)
+	}
+
+	idx := make([]int, len(dims))
+	var values []map[string]string
+	var labels []string
+	for {
+		vals := map[string]string{}
+		var label []string
+		d := 0
+		for _, p := range params {
+			v := p.value
+			for _, tok := range p.tokens {
+				v = strings.Replace(v, tok, dims[d][idx[d]], 1)
+				d++
+			}
+			vals[p.key] = v
+			label = append(label, p.key+"="+v)
+		}
+		values = append(values, vals)
+		labels = append(labels, strings.Join(label, " "))
+
+		// Bump the last dimension and carry as needed.
+		d = len(dims) - 1
+		for ; d >= 0; d-- {
+			idx[d]++
+			if idx[d] < len(dims[d]) {
+				break
+			}
+			idx[d] = 0
+		}
+		if d < 0 {
+			return values, labels
+		}
+	}
+}
+
+// setOption sets the JobData member matching the config file key to value.
+func (j *JobData) setOption(key, value string) error {
+	fieldName := strings.Replace(key, "-", "_", -1)
+	v := reflect.ValueOf(j).Elem()
+	var f reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).CanSet() && strings.EqualFold(v.Type().Field(i).Name, fieldName) {
+			f = v.Field(i)
+			break
+		}
+	}
+	if !f.IsValid() {
+		return fmt.Errorf("unknown option %s", key)
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int:
+		n, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %s", key, value)
+		}
+		f.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %s", key, value)
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("can't sweep %s", key)
+	}
+	return nil
+}
+
+//
+// expandSweeps -- replace each job using sweep(...) with one job per combination
+//
+// The copies are named <job>-0, <job>-1, ... and each one runs in its own barrier
+// in the place of the original job. All of the copies use the same target which is
+// only removed after the last one if it was created by the first.
+//
+func (c *Configs) expandSweeps() error {
+	c.sweeps = map[string][]string{}
+	for name, params := range c.sweepParams {
+		jd, ok := c.Job[name]
+		if !ok {
+			continue
+		}
+		values, labels := sweepCombinations(params)
+		created := false
+		delete(c.Job, name)
+		for n, vals := range values {
+			clone := *jd
+			for key, v := range vals {
+				if err := clone.setOption(key, v); err != nil {
+					return optionError(name, key, "%s", err)
+				}
+			}
+			// Every run of the sweep uses the same target, but numjobs
+			// copies run at the same time so each needs its own.
+			if clone.Name == "" {
+				clone.Name = c.Global.Name + name
+				if c.numjobs(&clone) > 1 {
+					clone.Name += ".$jobnum"
+				}
+			}
+			clone.sweepLabel = labels[n]
+			clone.sweepCreated = &created
+			clone.sweepLast = n == len(values)-1
+			cloneName := fmt.Sprintf("%s-%d", name, n)
+			c.Job[cloneName] = &clone
+			c.sweeps[name] = append(c.sweeps[name], cloneName)
+		}
+	}
+	return nil
+}
+
+// HaveSweeps returns true if any job in the configuration used sweep(...).
+func (c *Configs) HaveSweeps() bool {
+	return len(c.sweeps) != 0
+}
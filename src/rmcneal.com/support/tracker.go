@@ -4,6 +4,7 @@ package support
 import (
 	"fmt"
 	"os/signal"
+	"sync"
 	"time"
 )
 import "os"
@@ -19,13 +20,17 @@ type trackingInfo struct {
 	stopper  func()
 }
 
+// nodes is updated by the functions being tracked while WaitForThreads
+// displays and stops them so it's protected by mu.
 type tracking struct {
 	title        string
+	mu           sync.Mutex
 	nodes        map[string]*trackingInfo
 	printer      *Printer
 	count        int
 	completeChan chan threadStatus
 	display      func()
+	complete     func(name string, okay bool)
 }
 
 func TrackingInit(printer *Printer) *tracking {
@@ -48,13 +53,23 @@ func (t *tracking) RunFunc(name string, f func() bool, stopper func()) {
 	}()
 }
 
+// OnComplete has WaitForThreads call f as each function finishes. f is run on
+// the waiting goroutine and may use RunFunc to start more, WaitForThreads
+// returns once there's nothing left running.
+func (t *tracking) OnComplete(f func(name string, okay bool)) {
+	t.complete = f
+}
+
 func (t *tracking) SetTitle(title string) {
 	t.title = title
 }
 
 func (t *tracking) UpdateName(name string, extra string) {
-	ti := t.nodes[name]
-	ti.extraTag = extra
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ti, ok := t.nodes[name]; ok {
+		ti.extraTag = extra
+	}
 }
 
 func (t *tracking) DisplaySet(display func()) {
@@ -86,6 +101,7 @@ func (t *tracking) WaitForThreads() bool {
 
 	intrChans := make(chan os.Signal, 1)
 	signal.Notify(intrChans, os.Interrupt, os.Kill)
+	defer signal.Stop(intrChans)
 
 	tSec := time.Tick(time.Second)
 	for t.count > 0 {
@@ -99,24 +115,36 @@ func (t *tracking) WaitForThreads() bool {
 				returnState = false
 			}
 			t.removeNode(status.name)
+			if t.complete != nil {
+				t.complete(status.name, status.okay)
+			}
 
 		case <-tSec:
 			t.display()
 
 		case <-intrChans:
+			t.mu.Lock()
 			for _, v := range t.nodes {
-				v.stopper()
+				if v.seen && v.stopper != nil {
+					v.stopper()
+				}
 			}
+			t.mu.Unlock()
 		}
 	}
+	t.PrintDone()
+
+	return returnState
+}
+
+// PrintDone replaces the status line with one saying the current title is done.
+func (t *tracking) PrintDone() {
 	var cols = 80
 
 	if win, err := GetWinsize(os.Stdout.Fd()); err == nil {
 		cols = int(win.Width)
 	}
 	t.printer.Send("%*s\r%s ... done\n", cols-1, "", t.title)
-
-	return returnState
 }
 
 func (t *tracking) displayTrack() {
@@ -129,6 +157,8 @@ func (t *tracking) displayTrack() {
 	title := fmt.Sprintf("%s: ", t.title)
 	cols -= len(title)
 	t.printer.Send(title)
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	for k, v := range t.nodes {
 		if v.seen {
 			o := fmt.Sprintf("[%s%s] ", k, v.extraTag)
@@ -144,11 +174,15 @@ func (t *tracking) displayTrack() {
 }
 
 func (t *tracking) addNode(name string, stopper func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.nodes[name] = &trackingInfo{seen: true, extraTag: "", stopper: stopper}
 	t.count++
 }
 
 func (t *tracking) removeNode(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	ti := t.nodes[name]
 	ti.seen = false
 	t.count--
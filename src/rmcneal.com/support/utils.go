@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -69,26 +70,27 @@ func BlkStringToInt64(s string) (int64, bool) {
 	return size, true
 }
 
-var debugOn = false
-var debugIndex = 0
+// Atomic since a slave's run and intermediate stats threads both log.
+var debugOn int32
+var debugIndex int32
 
 func DebugLog(format string, a ...interface{}) {
-	if debugOn {
-		fmt.Printf("%*s", debugIndex, "")
+	if atomic.LoadInt32(&debugOn) != 0 {
+		fmt.Printf("%*s", atomic.LoadInt32(&debugIndex), "")
 		fmt.Printf(format, a...)
 	}
 }
 func DebugIncrease() {
-	debugIndex += 4
+	atomic.AddInt32(&debugIndex, 4)
 }
 func DebugDecrase() {
-	debugIndex -= 4
+	atomic.AddInt32(&debugIndex, -4)
 }
 func DebugEnable() {
-	debugOn = true
+	atomic.StoreInt32(&debugOn, 1)
 }
 func DebugDisable() {
-	debugOn = false
+	atomic.StoreInt32(&debugOn, 0)
 }
 
 func ClearStruct(v interface{}) {
@@ -330,6 +332,37 @@ func DashLine(pos ...int) string {
 	return rval
 }
 
+// FormatTable lines up rows under titles with a border around the table.
+// The first leftCols columns are left justified, the rest right justified.
+func FormatTable(titles []string, rows [][]string, leftCols int) string {
+	cols := make([]int, len(titles))
+	for _, row := range append(rows, titles) {
+		for i, v := range row {
+			if len(v) > cols[i] {
+				cols[i] = len(v)
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString(DashLine(cols...) + "\n")
+	for idx, row := range append([][]string{titles}, rows...) {
+		b.WriteString("|")
+		for i, v := range row {
+			if i < leftCols {
+				_, _ = fmt.Fprintf(&b, "%-*s|", cols[i], v)
+			} else {
+				_, _ = fmt.Fprintf(&b, "%*s|", cols[i], v)
+			}
+		}
+		b.WriteString("\n")
+		if idx == 0 {
+			b.WriteString(DashLine(cols...) + "\n")
+		}
+	}
+	b.WriteString(DashLine(cols...))
+	return b.String()
+}
+
 func FindComma(r rune) bool {
 	if r == rune(',') {
 		return true
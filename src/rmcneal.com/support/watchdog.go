@@ -0,0 +1,116 @@
+package support
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+//
+// ioSlot -- the I/O a worker is waiting on, for the io-timeout watchdog
+//
+// The worker fills in the I/O and then sets start, when it was issued in
+// UnixNano, and clears start once the I/O returns. The watchdog reads start,
+// then the I/O, then start again and ignores the slot if start changed in
+// between since the worker has moved on.
+//
+type ioSlot struct {
+	start int64
+	blk   int64
+	len   int64
+	op    int32
+}
+
+// issue and done do nothing on a nil slot, which is what workers have when
+// there's no io-timeout.
+func (s *ioSlot) issue(ad *AccessData, when time.Time) {
+	if s == nil {
+		return
+	}
+	atomic.StoreInt64(&s.blk, ad.blk)
+	atomic.StoreInt64(&s.len, ad.len)
+	atomic.StoreInt32(&s.op, int32(ad.op))
+	atomic.StoreInt64(&s.start, when.UnixNano())
+}
+
+func (s *ioSlot) done() {
+	if s == nil {
+		return
+	}
+	atomic.StoreInt64(&s.start, 0)
+}
+
+// hungIO is an I/O which hasn't returned yet.
+type hungIO struct {
+	worker int
+	op     int
+	blk    int64
+	len    int64
+	age    time.Duration
+}
+
+func (h hungIO) String() string {
+	if h.op == SyncType {
+		return fmt.Sprintf("worker %d Sync, outstanding %s", h.worker, h.age.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("worker %d %s at 0x%x, %s, outstanding %s", h.worker, opToString(h.op), h.blk,
+		Humanize(h.len, 1), h.age.Round(time.Millisecond))
+}
+
+// outstanding returns the slot's I/O, ok is false if there's none.
+func (s *ioSlot) outstanding(worker int, now time.Time) (h hungIO, ok bool) {
+	start := atomic.LoadInt64(&s.start)
+	if start == 0 {
+		return h, false
+	}
+	h = hungIO{worker: worker, op: int(atomic.LoadInt32(&s.op)), blk: atomic.LoadInt64(&s.blk),
+		len: atomic.LoadInt64(&s.len), age: now.Sub(time.Unix(0, start))}
+	return h, atomic.LoadInt64(&s.start) == start
+}
+
+// watchInterval is how often the watchdog looks at the workers. Checking twice
+// per io-timeout means an I/O is caught no later than half as long again.
+func (j *Job) watchInterval() time.Duration {
+	return j.JobParams.ioTimeout / 2
+}
+
+//
+// watchdog -- look for I/O's which have been outstanding longer than io-timeout
+//
+// Each one is reported with its offset, length and age every time the watchdog
+// runs. With io-timeout-abort the job is halted instead, all of the outstanding
+// I/O's are listed, and the workers which are stuck are returned so Start()
+// doesn't wait on them.
+//
+func (j *Job) watchdog(now time.Time) []int {
+	var hung, all []hungIO
+	for i := range j.slots {
+		if h, ok := j.slots[i].outstanding(i, now); ok {
+			all = append(all, h)
+			if h.age >= j.JobParams.ioTimeout {
+				hung = append(hung, h)
+			}
+		}
+	}
+	if len(hung) == 0 {
+		return nil
+	}
+	p := j.Stats.printer
+	if !j.JobParams.Io_Timeout_Abort {
+		for _, h := range hung {
+			p.Send("\n[%s] I/O timeout: %s\n", j.TargetName, h)
+		}
+		return nil
+	}
+	p.Send("\nERROR: [%s] %d I/O's exceeded io-timeout of %s, aborting the job. Outstanding I/O's:\n",
+		j.TargetName, len(hung), j.JobParams.ioTimeout)
+	for _, h := range all {
+		p.Send("  %s\n", h)
+	}
+	j.halt(StopTimeout)
+	workers := make([]int, len(hung))
+	for i, h := range hung {
+		workers[i] = h.worker
+	}
+	return workers
+}
@@ -0,0 +1,116 @@
+package support
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// stuckTarget blocks the first read, write or sync, whichever op is, until
+// release is closed.
+type stuckTarget struct {
+	target
+	op      int
+	once    sync.Once
+	release chan struct{}
+}
+
+func (s *stuckTarget) stick(op int) {
+	if op != s.op {
+		return
+	}
+	stuck := false
+	s.once.Do(func() { stuck = true })
+	if stuck {
+		<-s.release
+	}
+}
+
+func (s *stuckTarget) ReadAt(p []byte, off int64) (int, error) {
+	s.stick(ReadBaseType)
+	return s.target.ReadAt(p, off)
+}
+
+func (s *stuckTarget) WriteAt(p []byte, off int64) (int, error) {
+	s.stick(WriteBaseType)
+	return s.target.WriteAt(p, off)
+}
+
+func (s *stuckTarget) Sync() error {
+	s.stick(SyncType)
+	return s.target.Sync()
+}
+
+func TestIOTimeoutAbort(t *testing.T) {
+	j, stats := testJob(t, "runtime=1m\nio-timeout=100ms\nio-timeout-abort")
+	if err := j.FillAsNeeded(TrackingInit(PrintInit())); err != nil {
+		t.Fatal(err)
+	}
+	st := &stuckTarget{target: j.target, op: ReadBaseType, release: make(chan struct{})}
+	j.target = st
+
+	begin := time.Now()
+	if reason := j.Start(); reason != StopTimeout {
+		t.Errorf("job with a stuck read ended by %s", reason)
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("took %s to give up on the stuck read", elapsed)
+	}
+	stats.Flush()
+	if j.jobStat.errors != 1 || j.jobStat.stopReason != StopTimeout.String() {
+		t.Errorf("%d errors, stopped by %s", j.jobStat.errors, j.jobStat.stopReason)
+	}
+
+	// The abandoned worker still reports in once its read returns.
+	close(st.release)
+	<-j.thrCompletes
+}
+
+func TestIOTimeoutFillAndSync(t *testing.T) {
+	// A stuck write while the target is being filled fails the fill.
+	j, _ := testJob(t, "runtime=1m\nio-timeout=100ms\nio-timeout-abort\nfsync=1")
+	st := &stuckTarget{target: j.target, op: WriteBaseType, release: make(chan struct{})}
+	j.target = st
+	if err := j.FillAsNeeded(TrackingInit(PrintInit())); err == nil || j.reason() != StopTimeout {
+		t.Errorf("fill with a stuck write returned %v, stopped by %s", err, j.reason())
+	}
+	close(st.release)
+	<-j.thrCompletes
+
+	// So does an fsync which never returns.
+	j, stats := testJob(t, "runtime=1m\nio-timeout=100ms\nio-timeout-abort\nfsync=1")
+	if err := j.FillAsNeeded(TrackingInit(PrintInit())); err != nil {
+		t.Fatal(err)
+	}
+	st = &stuckTarget{target: j.target, op: SyncType, release: make(chan struct{})}
+	j.target = st
+	if reason := j.Start(); reason != StopTimeout {
+		t.Errorf("job with a stuck fsync ended by %s", reason)
+	}
+	stats.Flush()
+	if j.jobStat.errors != 1 {
+		t.Errorf("%d errors for the stuck fsync", j.jobStat.errors)
+	}
+	close(st.release)
+	<-j.thrCompletes
+}
+
+func TestIOSlot(t *testing.T) {
+	var s ioSlot
+	now := time.Now()
+	if _, ok := s.outstanding(0, now); ok {
+		t.Error("idle slot has an I/O")
+	}
+	s.issue(&AccessData{op: ReadBaseType, blk: 8192, len: 4096}, now.Add(-time.Second))
+	h, ok := s.outstanding(3, now)
+	if !ok || h.worker != 3 || h.blk != 8192 || h.len != 4096 || h.age != time.Second {
+		t.Errorf("got %+v", h)
+	}
+	s.done()
+	if _, ok := s.outstanding(0, now); ok {
+		t.Error("slot still busy after done")
+	}
+	var none *ioSlot
+	none.issue(&AccessData{}, now)
+	none.done()
+}